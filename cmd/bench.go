@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mrmarble/sandbox/pkg/replay"
+	"github.com/mrmarble/sandbox/pkg/sandbox"
+)
+
+// bench runs the same sandbox with different numbers of workers and prints
+// how many ticks per second each one simulated:
+//
+//	sandbox bench --in world.sav --ticks 500 --workers 1,2,4,0
+//
+// Every run must end with the same sandbox, so it also checks that the
+// result doesn't depend on the parallelism.
+func bench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	in := fs.String("in", "", "save file to start from, a built-in scene if empty")
+	ticks := fs.Int("ticks", 300, "number of ticks to run")
+	temp := fs.Bool("temp", true, "simulate temperature")
+	workers := fs.String("workers", "1,2,4,0", "comma separated numbers of chunks updated at once, 0 for one per CPU")
+	materials := fs.String("materials", "", "load material definitions from a JSON file")
+	fs.Parse(args)
+
+	if *ticks <= 0 {
+		return errors.New("--ticks must be positive")
+	}
+	var counts []int
+	for _, w := range strings.Split(*workers, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(w))
+		if err != nil {
+			return fmt.Errorf("invalid --workers: %w", err)
+		}
+		counts = append(counts, n)
+	}
+	if *materials != "" {
+		if err := sandbox.LoadMaterialsFile(*materials); err != nil {
+			return err
+		}
+	}
+
+	// Every run starts from a copy of the same save.
+	var start bytes.Buffer
+	if *in != "" {
+		s, err := readSave(*in)
+		if err != nil {
+			return err
+		}
+		if err := s.Save(&start); err != nil {
+			return err
+		}
+	} else if err := benchScene().Save(&start); err != nil {
+		return err
+	}
+
+	var first string
+	for _, n := range counts {
+		s, err := sandbox.Load(bytes.NewReader(start.Bytes()))
+		if err != nil {
+			return err
+		}
+		sandbox.SetParallelism(n)
+
+		begin := time.Now()
+		for i := 0; i < *ticks; i++ {
+			s.Update(*temp)
+		}
+		elapsed := time.Since(begin)
+
+		hash, err := replay.Hash(s)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("workers %d\t%8.1f ticks/s\thash %s\n", sandbox.Parallelism(), float64(*ticks)/elapsed.Seconds(), hash)
+		if first == "" {
+			first = hash
+		} else if hash != first {
+			return fmt.Errorf("%d workers ended with another sandbox", sandbox.Parallelism())
+		}
+	}
+	return nil
+}
+
+// benchScene returns a sandbox the size of the game window with layers of
+// falling, flowing, burning and melting materials.
+func benchScene() *sandbox.Sandbox {
+	const width, height = 590, 430
+	s := sandbox.NewSandbox(sandbox.SandboxConfig{
+		Width:       width,
+		Height:      height,
+		ChunkWidth:  sandbox.DefaultChunkSize,
+		ChunkHeight: sandbox.DefaultChunkSize,
+		Seed:        1,
+	})
+	layers := []sandbox.CellType{
+		sandbox.SAND, sandbox.WATER, sandbox.OIL, sandbox.FIRE,
+		sandbox.STONE, sandbox.LAVA, sandbox.ICE, sandbox.WOOD,
+	}
+	for i, m := range layers {
+		y := 30 + i*height/len(layers)
+		s.Paint(0, y, width-1, y, 30, m)
+	}
+	return s
+}
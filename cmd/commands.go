@@ -0,0 +1,26 @@
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// commands run without opening a window, as "sandbox <command> [flags]".
+var commands = map[string]func(args []string) error{
+	"run":    run,
+	"replay": playReplay,
+	"bench":  bench,
+}
+
+// writeFile creates the file at path and fills it with write.
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
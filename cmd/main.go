@@ -1,7 +1,11 @@
+//go:build !headless
+
 package main
 
 import (
 	"flag"
+	"image"
+	"image/png"
 	"log"
 	"os"
 	"runtime"
@@ -9,15 +13,42 @@ import (
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/mrmarble/sandbox/pkg/game"
+	"github.com/mrmarble/sandbox/pkg/sandbox"
+	"pgregory.net/rand"
 )
 
 var (
+	viewWidth, viewHeight = game.ViewSize()
+
+	materials = flag.String("materials", "", "load material definitions from a JSON file")
+	ambient   = flag.Float64("ambient", 0, "temperature every cell slowly relaxes toward")
+	rate      = flag.Float64("ambient_rate", sandbox.DefaultAmbientRate, "fraction of the difference with the ambient temperature lost every tick, 0 to keep the heat")
+	seed      = flag.Uint64("seed", 0, "seed of the simulation, random if 0")
+	unbounded = flag.Bool("unbounded", false, "play in a sandbox without edges, panned with the arrow keys")
+	width     = flag.Int("width", viewWidth, "width of the sandbox in cells")
+	height    = flag.Int("height", viewHeight, "height of the sandbox in cells")
+
+	chunkWidth  = flag.Int("chunk_width", sandbox.DefaultChunkSize, "width of the chunks in cells")
+	chunkHeight = flag.Int("chunk_height", sandbox.DefaultChunkSize, "height of the chunks in cells")
+	workers     = flag.Int("workers", 0, "number of chunks updated at once, 0 for one per CPU and 1 to update them one by one")
+
+	importPNG = flag.String("import", "", "start from the layout of a PNG image, matching pixels to material colors")
+	exportPNG = flag.String("export", "", "write the sandbox as a PNG image on exit")
+	record    = flag.String("record", "", "record the session to a replay file, written on exit")
+
 	debugCpuprofile     = flag.String("debug_cpuprofile", "", "write CPU profile to file")
 	debugMemprofile     = flag.String("debug_memprofile", "", "write memory profile to file")
 	debugMemprofileRate = flag.Int("debug_memprofile_rate", runtime.MemProfileRate, "fraction of bytes to be included in -debug_memprofile")
 )
 
 func main() {
+	if len(os.Args) > 1 && commands[os.Args[1]] != nil {
+		if err := commands[os.Args[1]](os.Args[2:]); err != nil {
+			log.Fatalf("%s: %v", os.Args[1], err)
+		}
+		return
+	}
+
 	flag.Parse()
 
 	if *debugMemprofile != "" {
@@ -52,9 +83,68 @@ func main() {
 			log.Fatalf("could not write memory profile: %v", err)
 		}
 	}
-	game := game.New()
+	if *materials != "" {
+		if err := sandbox.LoadMaterialsFile(*materials); err != nil {
+			log.Fatalf("could not load materials: %v", err)
+		}
+	}
+
+	sandbox.SetParallelism(*workers)
+
+	if *seed == 0 {
+		*seed = rand.Uint64()
+	}
+	config := sandbox.SandboxConfig{
+		Width:       *width,
+		Height:      *height,
+		ChunkWidth:  *chunkWidth,
+		ChunkHeight: *chunkHeight,
+		Seed:        *seed,
+	}
+	if *unbounded {
+		config.Width, config.Height = 0, 0
+	}
+	if err := config.Validate(); err != nil {
+		log.Fatalf("invalid sandbox: %v", err)
+	}
+	game := game.New(config)
+	defer game.Close()
+	game.SetAmbient(*ambient)
+	game.SetAmbientRate(*rate)
+	if *importPNG != "" {
+		img, err := readPNG(*importPNG)
+		if err != nil {
+			log.Fatalf("could not import image: %v", err)
+		}
+		game.Import(img)
+	}
+	if *record != "" {
+		if err := game.Record(); err != nil {
+			log.Fatalf("could not record: %v", err)
+		}
+	}
 
 	if err := ebiten.RunGame(game); err != nil {
 		panic(err)
 	}
+
+	if *exportPNG != "" {
+		if err := writeFile(*exportPNG, game.Export); err != nil {
+			log.Fatalf("could not export image: %v", err)
+		}
+	}
+	if *record != "" {
+		if err := writeFile(*record, game.SaveReplay); err != nil {
+			log.Fatalf("could not write replay: %v", err)
+		}
+	}
+}
+
+func readPNG(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return png.Decode(f)
 }
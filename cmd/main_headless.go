@@ -0,0 +1,19 @@
+//go:build headless
+
+package main
+
+import (
+	"log"
+	"os"
+)
+
+// Built with the headless tag, the binary doesn't link Ebitengine, so it runs
+// on machines without a display. Only the commands are available.
+func main() {
+	if len(os.Args) < 2 || commands[os.Args[1]] == nil {
+		log.Fatal("built without a window, only the run, replay and bench commands are available")
+	}
+	if err := commands[os.Args[1]](os.Args[2:]); err != nil {
+		log.Fatalf("%s: %v", os.Args[1], err)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/mrmarble/sandbox/pkg/replay"
+	"github.com/mrmarble/sandbox/pkg/sandbox"
+)
+
+// playReplay plays a recorded session back and prints the hash of the
+// sandbox it ends with, so two runs can be compared:
+//
+//	sandbox replay --in session.rpl --out result.sav
+func playReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	in := fs.String("in", "", "replay file to play")
+	out := fs.String("out", "", "save file to write the final sandbox to")
+	materials := fs.String("materials", "", "load material definitions from a JSON file")
+	fs.Parse(args)
+
+	if *in == "" {
+		return errors.New("missing --in replay file")
+	}
+	if *materials != "" {
+		if err := sandbox.LoadMaterialsFile(*materials); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	r, err := replay.Load(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %w", *in, err)
+	}
+
+	s, err := r.Play()
+	if err != nil {
+		return err
+	}
+	hash, err := replay.Hash(s)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("tick %d\nhash %s\n", s.Tick(), hash)
+
+	if *out != "" {
+		return writeFile(*out, s.Save)
+	}
+	return nil
+}
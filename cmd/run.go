@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mrmarble/sandbox/pkg/sandbox"
+)
+
+// run drives a saved sandbox for a number of ticks without opening a window:
+//
+//	sandbox run --headless --in world.sav --ticks 10000 --out result.sav
+func run(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	headless := fs.Bool("headless", false, "run without a window, the only mode supported")
+	in := fs.String("in", "", "save file to start from")
+	out := fs.String("out", "", "save file to write when done")
+	ticks := fs.Int("ticks", 1000, "number of ticks to run")
+	temp := fs.Bool("temp", true, "simulate temperature")
+	frames := fs.String("frames", "", "directory to write PNG frames to")
+	every := fs.Int("every", 100, "ticks between frames")
+	materials := fs.String("materials", "", "load material definitions from a JSON file")
+	chunkWidth := fs.Int("chunk_width", 0, "split the sandbox into chunks of this width, instead of the saved one")
+	chunkHeight := fs.Int("chunk_height", 0, "split the sandbox into chunks of this height, instead of the saved one")
+	workers := fs.Int("workers", 0, "number of chunks updated at once, 0 for one per CPU and 1 to update them one by one")
+	fs.Parse(args)
+
+	if !*headless {
+		return errors.New("only --headless runs are supported")
+	}
+	if *in == "" {
+		return errors.New("missing --in save file")
+	}
+	if *every <= 0 {
+		return errors.New("--every must be positive")
+	}
+	if *materials != "" {
+		if err := sandbox.LoadMaterialsFile(*materials); err != nil {
+			return err
+		}
+	}
+	sandbox.SetParallelism(*workers)
+
+	s, err := readSave(*in)
+	if err != nil {
+		return err
+	}
+	if *chunkWidth != 0 || *chunkHeight != 0 {
+		config := s.Config()
+		if *chunkWidth != 0 {
+			config.ChunkWidth = *chunkWidth
+		}
+		if *chunkHeight != 0 {
+			config.ChunkHeight = *chunkHeight
+		}
+		if s, err = s.Rechunked(config.ChunkWidth, config.ChunkHeight); err != nil {
+			return err
+		}
+	}
+	if *frames != "" {
+		if !s.Bounded() {
+			return errors.New("--frames needs a bounded sandbox")
+		}
+		if err := os.MkdirAll(*frames, 0o755); err != nil {
+			return err
+		}
+	}
+
+	start := time.Now()
+	for i := 1; i <= *ticks; i++ {
+		s.Update(*temp)
+		if *frames != "" && i%*every == 0 {
+			path := filepath.Join(*frames, fmt.Sprintf("frame_%06d.png", s.Tick()))
+			err := writeFile(path, func(w io.Writer) error {
+				img, err := s.Image(*temp)
+				if err != nil {
+					return err
+				}
+				return png.Encode(w, img)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	elapsed := time.Since(start)
+	config := s.Config()
+	log.Printf("ran %d ticks with %dx%d chunks in %v (%.1f ticks/s), now at tick %d",
+		*ticks, config.ChunkWidth, config.ChunkHeight, elapsed, float64(*ticks)/elapsed.Seconds(), s.Tick())
+
+	if *out != "" {
+		return writeFile(*out, s.Save)
+	}
+	return nil
+}
+
+func readSave(path string) (*sandbox.Sandbox, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s, err := sandbox.Load(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
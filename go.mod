@@ -4,21 +4,22 @@ go 1.19
 
 require (
 	github.com/hajimehoshi/bitmapfont v1.3.1
-	github.com/hajimehoshi/ebiten/v2 v2.4.12
+	github.com/hajimehoshi/ebiten/v2 v2.5.10
 	golang.org/x/exp v0.0.0-20221114191408-850992195362
 )
 
-require golang.org/x/text v0.4.0 // indirect
+require (
+	golang.org/x/sync v0.3.0 // indirect
+	golang.org/x/text v0.13.0 // indirect
+)
 
 require (
-	github.com/ebitengine/purego v0.0.0-20220905075623-aeed57cda744 // indirect
-	github.com/go-gl/glfw/v3.3/glfw v0.0.0-20220806181222-55e207c401ad // indirect
-	github.com/hajimehoshi/file2byteslice v0.0.0-20210813153925-5340248a8f41 // indirect
-	github.com/jezek/xgb v1.0.1 // indirect
-	github.com/orcaman/concurrent-map/v2 v2.0.1
-	golang.org/x/exp/shiny v0.0.0-20221114191408-850992195362 // indirect
-	golang.org/x/image v0.1.0 // indirect
-	golang.org/x/mobile v0.0.0-20220722155234-aaac322e2105 // indirect
-	golang.org/x/sys v0.2.0 // indirect
+	github.com/ebitengine/purego v0.4.1 // indirect
+	github.com/go-gl/glfw/v3.3/glfw v0.0.0-20221017161538-93cebf72946b // indirect
+	github.com/jezek/xgb v1.1.0 // indirect
+	golang.org/x/exp/shiny v0.0.0-20230817173708-d852ddb80c63 // indirect
+	golang.org/x/image v0.12.0 // indirect
+	golang.org/x/mobile v0.0.0-20230922142353-e2f452493d57 // indirect
+	golang.org/x/sys v0.12.0 // indirect
 	pgregory.net/rand v1.0.2
 )
@@ -16,19 +16,25 @@ func (g *Game) debugInfo(screen *ebiten.Image) {
 
 	if g.debug {
 		dbg += fmt.Sprintf("TPS: %0.2f\n", ebiten.ActualTPS())
-		curx, cury := offscreenCursor(g.cursorPos[0], g.cursorPos[1])
+		dbg += fmt.Sprintf("Seed: %d Tick: %d\n", g.sandbox.Seed(), g.sandbox.Tick())
+		dbg += fmt.Sprintf("Ambient: %s\n", g.tempUnit.format(g.sandbox.Ambient()))
+		curx, cury := g.worldCursor(g.cursorPos[0], g.cursorPos[1])
 		if g.sandbox.InBounds(curx, cury) {
 			cell := g.sandbox.GetCell(curx, cury)
 			if cell != nil {
 				dbg += fmt.Sprintf("Particle: %+v\n", cell)
+				dbg += fmt.Sprintf("Temperature: %s\n", g.tempUnit.format(cell.Temp()))
 			}
+			dbg += fmt.Sprintf("Pressure: %0.2f\n", g.sandbox.Pressure(curx, cury))
 		}
 		dbg += fmt.Sprintf("X: %d Y: %d\n", curx, cury)
 		for _, chunk := range g.sandbox.Chunks {
-			ui.Rect(g.offscreen, chunk.X*chunk.Width, chunk.Y*chunk.Height, chunk.Width, chunk.Height, color.RGBA{100, 0, 0, 100}, false)
-			text.Draw(g.offscreen, fmt.Sprintf("%d,%d", chunk.X, chunk.Y), bitmapfont.Gothic12r, chunk.X*chunk.Width+12, chunk.Y*chunk.Height+12, color.White)
+			min := chunk.Bounds().Min.Sub(g.camera)
+			x, y := min.X, min.Y
+			ui.Rect(g.offscreen, x, y, chunk.Width, chunk.Height, color.RGBA{100, 0, 0, 100}, false)
+			text.Draw(g.offscreen, fmt.Sprintf("%d,%d", chunk.X, chunk.Y), bitmapfont.Gothic12r, x+12, y+12, color.White)
 			if chunk.MaxX > 0 {
-				ui.Rect(g.offscreen, chunk.X*chunk.Width+chunk.MinX, chunk.Y*chunk.Height+chunk.MinY, chunk.MaxX-chunk.MinX, chunk.MaxY-chunk.MinY, color.RGBA{0, 100, 0, 100}, false)
+				ui.Rect(g.offscreen, x+chunk.MinX, y+chunk.MinY, chunk.MaxX-chunk.MinX, chunk.MaxY-chunk.MinY, color.RGBA{0, 100, 0, 100}, false)
 			}
 		}
 	}
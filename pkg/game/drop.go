@@ -0,0 +1,40 @@
+package game
+
+import (
+	"io/fs"
+	"log"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// readDrops sends the first file dropped onto the game since the last tick
+// to drops. It's read on another goroutine, as reading files dropped onto a
+// page takes a while.
+func readDrops(drops chan<- []byte) {
+	files := ebiten.DroppedFiles()
+	if files == nil {
+		return
+	}
+	go func() {
+		entries, err := fs.ReadDir(files, ".")
+		if err != nil {
+			log.Printf("dropped files: %v", err)
+			return
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				continue
+			}
+			data, err := fs.ReadFile(files, e.Name())
+			if err != nil {
+				log.Printf("dropped file: %v", err)
+				return
+			}
+			select {
+			case drops <- data:
+			default:
+			}
+			return
+		}
+	}()
+}
@@ -1,19 +1,26 @@
 package game
 
 import (
+	"bytes"
+	"image"
 	"image/color"
+	"image/png"
+	"io"
 	"log"
+	"os"
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/mrmarble/sandbox/pkg/replay"
 	"github.com/mrmarble/sandbox/pkg/sandbox"
 	"github.com/mrmarble/sandbox/pkg/ui"
 )
 
 var (
 	screenWidth  = 640
-	screenHeight = 480
+	screenHeight = 500
 	margin       = 50
+	menuHeight   = 20
 
 	offscrenOptions = &ebiten.DrawImageOptions{}
 )
@@ -26,8 +33,10 @@ type Game struct {
 	pause       bool
 	debug       bool
 	tempOverlay bool
+	tempUnit    tempUnit
 
 	brushSize int
+	selected  sandbox.CellType
 
 	prevPos   [2]int
 	cursorPos [2]int
@@ -35,20 +44,186 @@ type Game struct {
 	cellQueue [][2][2]int
 
 	offscreen *ebiten.Image
+
+	// drops receives the files dropped onto the game.
+	drops chan []byte
+
+	// replay records the session, if it's being recorded.
+	replay *replay.Replay
+
+	history *sandbox.History
+	// newStroke is set when the brush is pressed, so the next stroke begins
+	// a new edit in the history.
+	newStroke bool
+
+	// camera is the top left corner of the part of the sandbox shown.
+	camera image.Point
+	// chunkDir holds a directory for the unloaded chunks of every sandbox,
+	// or is empty if they are kept in memory.
+	chunkDir string
 }
 
-func New() *Game {
+// ViewSize returns the size of the part of the sandbox shown at once.
+func ViewSize() (int, int) {
+	return screenWidth - margin, screenHeight - margin - menuHeight
+}
+
+// New creates a game with a sandbox created from config, which must be
+// valid.
+func New(config sandbox.SandboxConfig) *Game {
 	ebiten.SetWindowTitle("Sandbox")
 	ebiten.SetTPS(ebiten.SyncWithFPS)
 	ebiten.SetWindowSize(screenWidth*2, screenHeight*2)
 
-	return &Game{
-		sandbox:     sandbox.NewSandbox(screenWidth-margin, screenHeight-margin),
+	s := sandbox.NewSandbox(config)
+	g := &Game{
+		sandbox:     s,
 		brushSize:   10,
+		selected:    sandbox.SAND,
 		tempOverlay: true,
-		offscreen:   ebiten.NewImage(screenWidth-margin, screenHeight-margin),
-		menu:        ui.NewMenu(margin/2, screenHeight-margin/2+5),
+		offscreen:   ebiten.NewImage(screenWidth-margin, screenHeight-margin-menuHeight),
+		menu:        ui.NewMenu(margin/2, screenHeight-menuHeight-margin/2+5, screenWidth-margin),
+		drops:       make(chan []byte, 1),
+		history:     sandbox.NewHistory(sandbox.DefaultHistoryBudget),
+	}
+
+	dir, err := os.MkdirTemp("", "sandbox-chunks")
+	if err != nil {
+		log.Printf("keeping unloaded chunks in memory: %v", err)
+	} else {
+		g.chunkDir = dir
+	}
+	g.useStore(s)
+	return g
+}
+
+// Close removes the unloaded chunks of the game.
+func (g *Game) Close() error {
+	if g.chunkDir == "" {
+		return nil
+	}
+	return os.RemoveAll(g.chunkDir)
+}
+
+// useStore unloads the chunks of s to a directory of its own.
+func (g *Game) useStore(s *sandbox.Sandbox) {
+	if g.chunkDir == "" {
+		return
+	}
+	dir, err := os.MkdirTemp(g.chunkDir, "world")
+	if err == nil {
+		err = s.SetStore(sandbox.DirStore(dir))
+	}
+	if err != nil {
+		log.Printf("keeping unloaded chunks in memory: %v", err)
+	}
+}
+
+// view returns the part of the sandbox shown.
+func (g *Game) view() image.Rectangle {
+	return g.offscreen.Bounds().Add(g.camera)
+}
+
+// worldCursor returns the cell of the sandbox under the screen position
+// x, y.
+func (g *Game) worldCursor(x, y int) (int, int) {
+	x, y = offscreenCursor(x, y)
+	return x + g.camera.X, y + g.camera.Y
+}
+
+// Import replaces the sandbox with the cells of img.
+func (g *Game) Import(img image.Image) {
+	s := g.sandbox.Cleared()
+	s.Import(img)
+	g.replace(s)
+	g.recordRestore()
+}
+
+// Export writes the sandbox as a PNG image to w, or the part of it shown if
+// it's unbounded.
+func (g *Game) Export(w io.Writer) error {
+	if !g.sandbox.Bounded() {
+		view := g.view()
+		img := image.NewRGBA(image.Rect(0, 0, view.Dx(), view.Dy()))
+		g.sandbox.Draw(img.Pix, view, false)
+		return png.Encode(w, img)
+	}
+	img, err := g.sandbox.Image(false)
+	if err != nil {
+		return err
 	}
+	return png.Encode(w, img)
+}
+
+// Record starts recording the session, from the current sandbox. The history
+// starts over with it.
+func (g *Game) Record() error {
+	r, s, err := replay.Record(g.sandbox)
+	if err != nil {
+		return err
+	}
+	g.replay = r
+	g.useStore(s)
+	g.setSandbox(s)
+	// The replay can't undo what happened before it started.
+	g.history = sandbox.NewHistory(sandbox.DefaultHistoryBudget)
+	g.record(replay.Event{Kind: replay.Select, Material: g.selected.String()})
+	g.record(replay.Event{Kind: replay.Temp, On: g.tempOverlay})
+	g.recordView()
+	return nil
+}
+
+// SaveReplay ends the recording and writes it to w.
+func (g *Game) SaveReplay(w io.Writer) error {
+	g.record(replay.Event{Kind: replay.End})
+	return g.replay.Save(w)
+}
+
+// record adds e to the replay at the current tick, if recording.
+func (g *Game) record(e replay.Event) {
+	if g.replay != nil {
+		e.Tick = g.sandbox.Tick()
+		g.replay.Add(e)
+	}
+}
+
+func (g *Game) recordView() {
+	v := g.sandbox.View()
+	g.record(replay.Event{Kind: replay.View, X0: v.Min.X, Y0: v.Min.Y, X1: v.Max.X, Y1: v.Max.Y})
+}
+
+// recordRestore records that the sandbox was replaced by one the replay can't
+// recreate, like a loaded or imported one. As when the recording starts, the
+// game goes on with the copy the replay restores.
+func (g *Game) recordRestore() {
+	if g.replay == nil {
+		return
+	}
+	var buf bytes.Buffer
+	if err := g.sandbox.Save(&buf); err != nil {
+		log.Printf("replay: %v", err)
+		return
+	}
+	s, err := sandbox.Load(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		log.Printf("replay: %v", err)
+		return
+	}
+	g.record(replay.Event{Kind: replay.Restore, Data: buf.Bytes()})
+	g.useStore(s)
+	g.setSandbox(s)
+}
+
+// SetAmbient sets the temperature the sandbox relaxes toward.
+func (g *Game) SetAmbient(temp float64) {
+	g.setAmbient(temp)
+}
+
+// SetAmbientRate sets how fast the sandbox relaxes toward the ambient
+// temperature, 0 to keep its heat. It must be set before recording, as
+// replays only get it from their starting sandbox.
+func (g *Game) SetAmbientRate(rate float64) {
+	g.sandbox.SetAmbientRate(rate)
 }
 
 func (g *Game) Layout(outsideWidth, outsideHeight int) (int, int) {
@@ -60,9 +235,33 @@ func (g *Game) Update() error {
 	g.updateCursor()
 	g.handleInput()
 	g.menu.Update()
+	if selected := g.menu.GetSelected(); selected != g.selected {
+		g.selected = selected
+		g.record(replay.Event{Kind: replay.Select, Material: selected.String()})
+	}
 	g.placeQueueParticles()
 
-	if !g.pause || inpututil.IsKeyJustPressed(ebiten.KeyPeriod) {
+	readDrops(g.drops)
+	select {
+	case data := <-g.drops:
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			log.Printf("dropped file: %v", err)
+			break
+		}
+		g.Import(img)
+	default:
+	}
+
+	if v := g.view(); v != g.sandbox.View() {
+		g.sandbox.SetView(v)
+		g.recordView()
+	}
+
+	if g.pause && inpututil.IsKeyJustPressed(ebiten.KeyPeriod) {
+		g.record(replay.Event{Kind: replay.Step})
+		g.sandbox.Update(g.tempOverlay)
+	} else if !g.pause {
 		g.sandbox.Update(g.tempOverlay)
 	}
 	return nil
@@ -75,14 +274,14 @@ func (g *Game) Draw(screen *ebiten.Image) {
 		offscrenOptions.GeoM.Translate(float64(margin/2), float64(margin/2))
 	}
 
-	g.sandbox.Draw(g.pixels, g.offscreen.Bounds().Dx(), g.tempOverlay)
+	g.sandbox.Draw(g.pixels, g.view(), g.tempOverlay)
 	g.offscreen.WritePixels(g.pixels)
 
 	// Brush size
 	offscreenX, offscreenY := offscreenCursor(g.cursorPos[0], g.cursorPos[1])
 	ui.Rect(g.offscreen, offscreenX-g.brushSize/2, offscreenY-g.brushSize/2, g.brushSize, g.brushSize, color.White, false)
 	// Border
-	ui.Rect(g.offscreen, 0, 0, screenWidth-margin, screenHeight-margin, color.RGBA{20, 20, 20, 100}, false)
+	ui.Rect(g.offscreen, 0, 0, screenWidth-margin, screenHeight-margin-menuHeight, color.RGBA{20, 20, 20, 100}, false)
 
 	g.menu.Draw(screen)
 	g.debugInfo(screen)
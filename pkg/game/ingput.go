@@ -1,14 +1,20 @@
 package game
 
 import (
-	"math"
+	"image"
+	"log"
+	"os"
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/mrmarble/sandbox/pkg/misc"
+	"github.com/mrmarble/sandbox/pkg/replay"
 	"github.com/mrmarble/sandbox/pkg/sandbox"
 )
 
+// panSpeed is how many cells the camera moves per frame.
+const panSpeed = 4
+
 func (g *Game) updateCursor() {
 	g.prevPos = g.cursorPos
 	x, y := ebiten.CursorPosition()
@@ -16,10 +22,22 @@ func (g *Game) updateCursor() {
 }
 
 func (g *Game) handleInput() {
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		g.newStroke = true
+	}
 	if ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
-		prevX, prevY := offscreenCursor(g.prevPos[0], g.prevPos[1])
-		x, y := offscreenCursor(g.cursorPos[0], g.cursorPos[1])
-		g.cellQueue = append(g.cellQueue, [2][2]int{{prevX, prevY}, {x, y}})
+		prevX, prevY := g.worldCursor(g.prevPos[0], g.prevPos[1])
+		x, y := g.worldCursor(g.cursorPos[0], g.cursorPos[1])
+		// Clicks on the menu select materials, they don't paint.
+		if image.Pt(x, y).In(g.view()) {
+			g.cellQueue = append(g.cellQueue, [2][2]int{{prevX, prevY}, {x, y}})
+		}
+	}
+
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonRight) {
+		x, y := g.worldCursor(g.cursorPos[0], g.cursorPos[1])
+		g.record(replay.Event{Kind: replay.Toggle, X0: x, Y0: y})
+		g.sandbox.Toggle(x, y)
 	}
 
 	_, scrollY := ebiten.Wheel()
@@ -29,69 +47,133 @@ func (g *Game) handleInput() {
 		g.brushSize = misc.Max(2, g.brushSize-2)
 	}
 
+	if ebiten.IsKeyPressed(ebiten.KeyArrowLeft) {
+		g.camera.X -= panSpeed
+	}
+	if ebiten.IsKeyPressed(ebiten.KeyArrowRight) {
+		g.camera.X += panSpeed
+	}
+	if ebiten.IsKeyPressed(ebiten.KeyArrowUp) {
+		g.camera.Y -= panSpeed
+	}
+	if ebiten.IsKeyPressed(ebiten.KeyArrowDown) {
+		g.camera.Y += panSpeed
+	}
+
 	if inpututil.IsKeyJustPressed(ebiten.KeyP) {
 		g.pause = !g.pause
+		g.record(replay.Event{Kind: replay.Pause, On: g.pause})
 	}
 
 	if inpututil.IsKeyJustPressed(ebiten.KeyT) {
 		g.tempOverlay = !g.tempOverlay
+		g.record(replay.Event{Kind: replay.Temp, On: g.tempOverlay})
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyBracketLeft) {
+		g.setAmbient(g.sandbox.Ambient() - 10)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyBracketRight) {
+		g.setAmbient(g.sandbox.Ambient() + 10)
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyU) {
+		g.tempUnit = g.tempUnit.next()
 	}
 
 	if inpututil.IsKeyJustPressed(ebiten.KeyD) {
 		g.debug = !g.debug
 	}
 
-	if inpututil.IsKeyJustPressed(ebiten.KeySpace) {
-		g.sandbox = sandbox.NewSandbox(screenWidth-margin, screenHeight-margin)
-		g.pixels = nil
-		offscrenOptions.GeoM.Reset()
+	if inpututil.IsKeyJustPressed(ebiten.KeyF5) {
+		if err := g.quickSave(); err != nil {
+			log.Printf("quick-save: %v", err)
+		}
 	}
-}
 
-func (g *Game) placeQueueParticles() {
-	for {
-		if len(g.cellQueue) == 0 {
-			break
+	if inpututil.IsKeyJustPressed(ebiten.KeyF9) {
+		if err := g.quickLoad(); err != nil {
+			log.Printf("quick-load: %v", err)
 		}
+	}
 
-		p1, p2 := g.cellQueue[0][0], g.cellQueue[0][1]
-		g.cellQueue = g.cellQueue[1:]
-		p1x, p1y := p1[0], p1[1]
-		p2x, p2y := p2[0], p2[1]
+	if inpututil.IsKeyJustPressed(ebiten.KeySpace) {
+		g.clear()
+	}
 
-		dx := int(math.Abs(float64(p2x - p1x)))
-		sx := -1
-		if p1x < p2x {
-			sx = 1
-		}
-		dy := -int(math.Abs(float64(p2y - p1y)))
-		sy := -1
-		if p1y < p2y {
-			sy = 1
+	if ebiten.IsKeyPressed(ebiten.KeyControl) {
+		if inpututil.IsKeyJustPressed(ebiten.KeyZ) {
+			g.record(replay.Event{Kind: replay.Undo})
+			g.setSandbox(g.history.Undo(g.sandbox))
 		}
-		err := dx + dy
-		for {
-			for x := p1x - (g.brushSize / 2); x < (p1x + g.brushSize/2); x++ {
-				for y := p1y - (g.brushSize / 2); y < (p1y + g.brushSize/2); y++ {
-					if x >= 0 && x < screenWidth && y >= 0 && y < screenHeight {
-						if g.menu.GetSelected() == sandbox.AIR || g.sandbox.IsEmpty(x, y) {
-							g.sandbox.SetCell(x, y, sandbox.NewCell(g.menu.GetSelected()))
-						}
-					}
-				}
-			}
-			if p1x == p2x && p1y == p2y {
-				break
-			}
-			e2 := 2 * err
-			if e2 >= dy {
-				err += dy
-				p1x += sx
-			}
-			if e2 <= dx {
-				err += dx
-				p1y += sy
-			}
+		if inpututil.IsKeyJustPressed(ebiten.KeyY) {
+			g.record(replay.Event{Kind: replay.Redo})
+			g.setSandbox(g.history.Redo(g.sandbox))
 		}
 	}
 }
+
+func (g *Game) setAmbient(temp float64) {
+	g.record(replay.Event{Kind: replay.Ambient, Value: temp})
+	g.sandbox.SetAmbient(temp)
+}
+
+// clear replaces the sandbox with an empty one with the same settings.
+func (g *Game) clear() {
+	g.record(replay.Event{Kind: replay.Clear})
+	g.replace(g.sandbox.Cleared())
+}
+
+// replace replaces the sandbox with s, keeping the old one in the history.
+func (g *Game) replace(s *sandbox.Sandbox) {
+	g.useStore(s)
+	g.history.Replace(g.sandbox)
+	g.setSandbox(s)
+}
+
+func (g *Game) setSandbox(s *sandbox.Sandbox) {
+	g.sandbox = s
+	g.pixels = nil
+	offscrenOptions.GeoM.Reset()
+}
+
+// quickSaveFile is where the sandbox is quick-saved to.
+const quickSaveFile = "quicksave.sav"
+
+func (g *Game) quickSave() error {
+	f, err := os.Create(quickSaveFile)
+	if err != nil {
+		return err
+	}
+	if err := g.sandbox.Save(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (g *Game) quickLoad() error {
+	f, err := os.Open(quickSaveFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	s, err := sandbox.Load(f)
+	if err != nil {
+		return err
+	}
+	g.replace(s)
+	g.recordRestore()
+	return nil
+}
+
+func (g *Game) placeQueueParticles() {
+	for _, stroke := range g.cellQueue {
+		from, to := stroke[0], stroke[1]
+		g.record(replay.Event{Kind: replay.Stroke, X0: from[0], Y0: from[1], X1: to[0], Y1: to[1], Size: g.brushSize, On: g.newStroke})
+		g.history.Paint(g.sandbox, from[0], from[1], to[0], to[1], g.brushSize, g.selected, g.newStroke)
+		g.newStroke = false
+	}
+	g.cellQueue = g.cellQueue[:0]
+}
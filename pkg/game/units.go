@@ -0,0 +1,29 @@
+package game
+
+import "fmt"
+
+// tempUnit is the unit temperatures are shown in.
+type tempUnit int
+
+const (
+	celsius tempUnit = iota
+	kelvin
+	fahrenheit
+)
+
+// next returns the unit shown after u when cycling through them.
+func (u tempUnit) next() tempUnit {
+	return (u + 1) % 3
+}
+
+// format formats a temperature given in degrees Celsius.
+func (u tempUnit) format(temp float64) string {
+	switch u {
+	case kelvin:
+		return fmt.Sprintf("%0.2f K", temp+273.15)
+	case fahrenheit:
+		return fmt.Sprintf("%0.2f °F", temp*9/5+32)
+	default:
+		return fmt.Sprintf("%0.2f °C", temp)
+	}
+}
@@ -25,3 +25,10 @@ func Clamp[T constraints.Ordered](x, min, max T) T {
 	}
 	return x
 }
+
+func Abs[T constraints.Signed | constraints.Float](x T) T {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,197 @@
+package replay
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Replay files start with fileMagic and fileVersion, followed by the save
+// of the starting sandbox and the events. Every event is its kind, its tick
+// and the fields of its kind.
+const (
+	fileMagic   = "SRPL"
+	fileVersion = 1
+
+	// maxData is the largest save a replay can hold.
+	maxData = 256 << 20
+)
+
+type fileWriter struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (w *fileWriter) uvarint(v uint64) {
+	w.w.Write(w.buf[:binary.PutUvarint(w.buf[:], v)])
+}
+
+func (w *fileWriter) varint(v int64) {
+	w.w.Write(w.buf[:binary.PutVarint(w.buf[:], v)])
+}
+
+func (w *fileWriter) float(f float64) {
+	binary.LittleEndian.PutUint64(w.buf[:8], math.Float64bits(f))
+	w.w.Write(w.buf[:8])
+}
+
+func (w *fileWriter) bool(b bool) {
+	if b {
+		w.w.WriteByte(1)
+	} else {
+		w.w.WriteByte(0)
+	}
+}
+
+func (w *fileWriter) bytes(b []byte) {
+	w.uvarint(uint64(len(b)))
+	w.w.Write(b)
+}
+
+// Save writes the replay to w.
+func (r *Replay) Save(w io.Writer) error {
+	fw := &fileWriter{w: bufio.NewWriter(w)}
+	fw.w.WriteString(fileMagic)
+	fw.uvarint(fileVersion)
+	fw.bytes(r.start)
+
+	fw.uvarint(uint64(len(r.Events)))
+	for _, e := range r.Events {
+		fw.w.WriteByte(byte(e.Kind))
+		fw.uvarint(e.Tick)
+		switch e.Kind {
+		case Stroke:
+			fw.varint(int64(e.X0))
+			fw.varint(int64(e.Y0))
+			fw.varint(int64(e.X1))
+			fw.varint(int64(e.Y1))
+			fw.varint(int64(e.Size))
+			fw.bool(e.On)
+		case Select:
+			fw.bytes([]byte(e.Material))
+		case Toggle:
+			fw.varint(int64(e.X0))
+			fw.varint(int64(e.Y0))
+		case View:
+			fw.varint(int64(e.X0))
+			fw.varint(int64(e.Y0))
+			fw.varint(int64(e.X1))
+			fw.varint(int64(e.Y1))
+		case Ambient:
+			fw.float(e.Value)
+		case Pause, Temp:
+			fw.bool(e.On)
+		case Restore:
+			fw.bytes(e.Data)
+		}
+	}
+	return fw.w.Flush()
+}
+
+type fileReader struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (r *fileReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(r.r)
+	r.err = err
+	return v
+}
+
+func (r *fileReader) varint() int {
+	if r.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(r.r)
+	if err == nil && (v < math.MinInt32 || v > math.MaxInt32) {
+		err = fmt.Errorf("coordinate %d out of range", v)
+	}
+	r.err = err
+	return int(v)
+}
+
+func (r *fileReader) float() float64 {
+	var buf [8]byte
+	if r.err == nil {
+		_, r.err = io.ReadFull(r.r, buf[:])
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(buf[:]))
+}
+
+func (r *fileReader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	b, err := r.r.ReadByte()
+	r.err = err
+	return b
+}
+
+func (r *fileReader) bytes(max int) []byte {
+	n := r.uvarint()
+	if r.err != nil {
+		return nil
+	}
+	if n > uint64(max) {
+		r.err = fmt.Errorf("field of %d bytes is too long", n)
+		return nil
+	}
+	b := make([]byte, n)
+	_, r.err = io.ReadFull(r.r, b)
+	return b
+}
+
+// Load reads a replay written by Replay.Save.
+func Load(r io.Reader) (*Replay, error) {
+	fr := &fileReader{r: bufio.NewReader(r)}
+	magic := make([]byte, len(fileMagic))
+	if _, err := io.ReadFull(fr.r, magic); err != nil || string(magic) != fileMagic {
+		return nil, errors.New("not a replay file")
+	}
+	if version := fr.uvarint(); fr.err == nil && version != fileVersion {
+		return nil, fmt.Errorf("unsupported replay version %d", version)
+	}
+
+	rp := &Replay{start: fr.bytes(maxData)}
+	events := fr.uvarint()
+	for i := uint64(0); i < events && fr.err == nil; i++ {
+		e := Event{Kind: Kind(fr.byte()), Tick: fr.uvarint()}
+		switch e.Kind {
+		case Stroke:
+			e.X0, e.Y0 = fr.varint(), fr.varint()
+			e.X1, e.Y1 = fr.varint(), fr.varint()
+			e.Size = fr.varint()
+			e.On = fr.byte() != 0
+		case Select:
+			e.Material = string(fr.bytes(64))
+		case Toggle:
+			e.X0, e.Y0 = fr.varint(), fr.varint()
+		case View:
+			e.X0, e.Y0 = fr.varint(), fr.varint()
+			e.X1, e.Y1 = fr.varint(), fr.varint()
+		case Ambient:
+			e.Value = fr.float()
+		case Pause, Temp:
+			e.On = fr.byte() != 0
+		case Restore:
+			e.Data = fr.bytes(maxData)
+		case Step, Clear, End, Undo, Redo:
+		default:
+			if fr.err == nil {
+				return nil, fmt.Errorf("event %d: unknown kind %d", i, e.Kind)
+			}
+		}
+		rp.Events = append(rp.Events, e)
+	}
+	if fr.err != nil {
+		return nil, fr.err
+	}
+	return rp, nil
+}
@@ -0,0 +1,158 @@
+// Package replay records what the player does to a sandbox, so that a
+// session can be played back exactly from the same starting sandbox.
+package replay
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+
+	"github.com/mrmarble/sandbox/pkg/sandbox"
+)
+
+type Kind uint8
+
+const (
+	// Stroke paints the line from X0, Y0 to X1, Y1 with a brush of Size. On
+	// marks the first stroke of a drag, which is undone along with the
+	// strokes following it.
+	Stroke Kind = iota + 1
+	// Select selects the Material painted by the next strokes.
+	Select
+	// Pause pauses the game if On, and resumes it otherwise.
+	Pause
+	// Step advances the paused game by one tick.
+	Step
+	// Clear replaces the sandbox with an empty one.
+	Clear
+	// Toggle toggles the switch at X0, Y0.
+	Toggle
+	// Ambient sets the ambient temperature to Value.
+	Ambient
+	// Temp simulates temperature if On.
+	Temp
+	// Restore replaces the sandbox with the one saved in Data.
+	Restore
+	// End marks the tick the recording stopped at.
+	End
+	// Undo undoes the last stroke or replaced sandbox.
+	Undo
+	// Redo redoes the last undone stroke or replaced sandbox.
+	Redo
+	// View sets the view of the sandbox to X0, Y0, X1, Y1, which decides
+	// what chunks are simulated.
+	View
+)
+
+// maxBrushSize is the largest brush a stroke can be played with.
+const maxBrushSize = 1024
+
+// Event is something the player did, at the tick of the sandbox it was done
+// to. Only the fields of its kind are used.
+type Event struct {
+	Tick uint64
+	Kind Kind
+
+	X0, Y0, X1, Y1 int
+	Size           int
+	Material       string
+	Value          float64
+	On             bool
+	Data           []byte
+}
+
+// Replay is a starting sandbox and the events that happened to it.
+type Replay struct {
+	start  []byte
+	Events []Event
+}
+
+// Record starts a replay from the current state of s. It returns the copy of
+// s the replay starts from, which the session must go on with, as a save
+// doesn't keep everything about a sandbox, like its view.
+func Record(s *sandbox.Sandbox) (*Replay, *sandbox.Sandbox, error) {
+	var buf bytes.Buffer
+	if err := s.Save(&buf); err != nil {
+		return nil, nil, err
+	}
+	start, err := sandbox.Load(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return nil, nil, err
+	}
+	return &Replay{start: buf.Bytes()}, start, nil
+}
+
+// Add appends e to the replay. Events must be added in the order they
+// happened.
+func (r *Replay) Add(e Event) {
+	r.Events = append(r.Events, e)
+}
+
+// Play runs the replay from its starting sandbox and returns the sandbox it
+// ends with. Between events, the sandbox is updated until it reaches the
+// tick of the next one, so Pause and Step don't change it by themselves.
+func (r *Replay) Play() (*sandbox.Sandbox, error) {
+	s, err := sandbox.Load(bytes.NewReader(r.start))
+	if err != nil {
+		return nil, err
+	}
+
+	// The game starts with sand selected and temperature simulated.
+	material, temp := sandbox.SAND, true
+	history := sandbox.NewHistory(sandbox.DefaultHistoryBudget)
+	for i, e := range r.Events {
+		if e.Tick < s.Tick() {
+			return nil, fmt.Errorf("event %d: at tick %d, but the sandbox is at tick %d", i, e.Tick, s.Tick())
+		}
+		for s.Tick() < e.Tick {
+			s.Update(temp)
+		}
+
+		switch e.Kind {
+		case Stroke:
+			if e.Size < 0 || e.Size > maxBrushSize {
+				return nil, fmt.Errorf("event %d: invalid brush size %d", i, e.Size)
+			}
+			history.Paint(s, e.X0, e.Y0, e.X1, e.Y1, e.Size, material, e.On)
+		case Select:
+			cType, ok := sandbox.Materials.Lookup(e.Material)
+			if !ok {
+				return nil, fmt.Errorf("event %d: unknown material %q", i, e.Material)
+			}
+			material = cType
+		case Clear:
+			history.Replace(s)
+			s = s.Cleared()
+		case Toggle:
+			s.Toggle(e.X0, e.Y0)
+		case Ambient:
+			s.SetAmbient(e.Value)
+		case Temp:
+			temp = e.On
+		case Restore:
+			history.Replace(s)
+			if s, err = sandbox.Load(bytes.NewReader(e.Data)); err != nil {
+				return nil, fmt.Errorf("event %d: %w", i, err)
+			}
+		case Undo:
+			s = history.Undo(s)
+		case Redo:
+			s = history.Redo(s)
+		case View:
+			s.SetView(image.Rect(e.X0, e.Y0, e.X1, e.Y1))
+		}
+	}
+	return s, nil
+}
+
+// Hash returns a digest of the whole state of s, so two sandboxes can be
+// compared by their hashes.
+func Hash(s *sandbox.Sandbox) (string, error) {
+	h := sha256.New()
+	if err := s.Save(h); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
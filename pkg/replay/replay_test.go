@@ -0,0 +1,89 @@
+package replay
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mrmarble/sandbox/pkg/sandbox"
+)
+
+// painted returns a sandbox with freshly painted cells, awake unlike the
+// cells of a loaded sandbox.
+func painted() *sandbox.Sandbox {
+	s := sandbox.NewSandbox(sandbox.SandboxConfig{
+		Width:       200,
+		Height:      150,
+		ChunkWidth:  sandbox.DefaultChunkSize,
+		ChunkHeight: sandbox.DefaultChunkSize,
+		Seed:        5,
+	})
+	s.Paint(0, 140, 199, 140, 6, sandbox.STONE)
+	s.Paint(20, 20, 180, 60, 10, sandbox.SAND)
+	s.Paint(180, 20, 20, 60, 10, sandbox.WATER)
+	s.Paint(100, 100, 100, 100, 16, sandbox.FIRE)
+	return s
+}
+
+// sameHash fails the test if a and b don't have the same hash.
+func sameHash(t *testing.T, a, b *sandbox.Sandbox) {
+	t.Helper()
+	ha, err := Hash(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hb, err := Hash(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ha != hb {
+		t.Fatal("the replay ended with another sandbox")
+	}
+}
+
+func TestRecordPaintedSandbox(t *testing.T) {
+	r, s, err := Record(painted())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		s.Update(true)
+	}
+	r.Add(Event{Tick: s.Tick(), Kind: End})
+
+	played, err := r.Play()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameHash(t, s, played)
+}
+
+func TestRecordRestoredSandbox(t *testing.T) {
+	r, s, err := Record(painted())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		s.Update(true)
+	}
+
+	// Like the game does when it imports a sandbox, go on with the copy
+	// the replay restores.
+	var buf bytes.Buffer
+	if err := painted().Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	r.Add(Event{Tick: s.Tick(), Kind: Restore, Data: buf.Bytes()})
+	if s, err = sandbox.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		s.Update(true)
+	}
+	r.Add(Event{Tick: s.Tick(), Kind: End})
+
+	played, err := r.Play()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameHash(t, s, played)
+}
@@ -1,16 +1,34 @@
 package sandbox
 
 import (
+	"math"
+
 	"github.com/mrmarble/sandbox/pkg/misc"
-	"pgregory.net/rand"
 )
 
-func (w *Worker) UpdateSteam(x, y int) {
-	cell := w.GetCell(x, y)
-	if cell.temp < 100 {
-		w.SetCell(x, y, NewCell(WATER))
-	}
-}
+const (
+	// Gravity is the acceleration of falling cells in cells per tick².
+	Gravity = 0.3
+	// TerminalVelocity is the maximum speed of falling cells in cells per
+	// tick.
+	TerminalVelocity = 8
+	// Friction is the horizontal speed kept by cells resting on the ground.
+	Friction = 0.5
+	// Drag is the horizontal speed kept by moving cells.
+	Drag = 0.9
+	// AcidStrength is the chance per tick of acid dissolving a neighbour
+	// without any resistance.
+	AcidStrength = 0.2
+	// AcidUses is how many cells acid dissolves before it is spent.
+	AcidUses = 3
+	// OilBurnTime is how many ticks burning oil lasts before turning into
+	// fire.
+	OilBurnTime = 120
+	// OilIgnitionTemp is the temperature at which oil catches fire on its own.
+	OilIgnitionTemp = 150
+	// IceChill is the heat ice takes from each warmer neighbour every tick.
+	IceChill = 2
+)
 
 func (w *Worker) UpdateReplicator(x, y int) {
 	cell := w.GetCell(x, y)
@@ -21,7 +39,7 @@ func (w *Worker) UpdateReplicator(x, y int) {
 		if !isEmpty(other) && other.CType != CLNE {
 			cell.extraData1 = 1
 			if w.IsEmpty(x, y+2) {
-				w.SetCell(x, y+2, NewCell(other.CType))
+				w.SetCell(x, y+2, w.NewCell(other.CType))
 			}
 		}
 	}
@@ -30,7 +48,7 @@ func (w *Worker) UpdateReplicator(x, y int) {
 		if !isEmpty(other) && other.CType != CLNE {
 			cell.extraData1 = 1
 			if w.IsEmpty(x, y-2) {
-				w.SetCell(x, y-2, NewCell(other.CType))
+				w.SetCell(x, y-2, w.NewCell(other.CType))
 			}
 		}
 	}
@@ -39,7 +57,7 @@ func (w *Worker) UpdateReplicator(x, y int) {
 		if !isEmpty(other) && other.CType != CLNE {
 			cell.extraData1 = 1
 			if w.IsEmpty(x+2, y) {
-				w.SetCell(x+2, y, NewCell(other.CType))
+				w.SetCell(x+2, y, w.NewCell(other.CType))
 			}
 		}
 	}
@@ -48,7 +66,7 @@ func (w *Worker) UpdateReplicator(x, y int) {
 		if !isEmpty(other) && other.CType != CLNE {
 			cell.extraData1 = 1
 			if w.IsEmpty(x-2, y) {
-				w.SetCell(x-2, y, NewCell(other.CType))
+				w.SetCell(x-2, y, w.NewCell(other.CType))
 			}
 		}
 	}
@@ -56,15 +74,11 @@ func (w *Worker) UpdateReplicator(x, y int) {
 
 func (w *Worker) UpdatePlant(x, y int) {
 	cell := w.GetCell(x, y)
-	if cell.temp >= 100 {
-		w.SetCell(x, y, NewCell(FIRE))
-		return
-	}
 
 	if w.InBounds(x, y+1) {
 		other := w.GetCell(x, y+1)
 		if !isEmpty(other) {
-			if other.CType == SAND && other.extraData1 == 1 {
+			if other.CType == MUD {
 				cell.extraData2 = 1
 			}
 			if other.CType == PLANT && other.extraData2 == 1 {
@@ -73,16 +87,16 @@ func (w *Worker) UpdatePlant(x, y int) {
 		}
 	}
 
-	if y > 0 {
+	if w.sandbox.inWorld(x, y-1) {
 		if cell.extraData2 == 1 {
 			extraData1 := cell.extraData1
 			if extraData1 > 0 {
-				xOffset := rand.Intn(3) - 1
-				yOffset := rand.Intn(6) - 2
+				xOffset := w.rand.Intn(3) - 1
+				yOffset := w.rand.Intn(6) - 2
 				x += xOffset
 				y += yOffset
 				if w.InBounds(x, y) && w.IsEmpty(x, y) {
-					child := NewCell(PLANT)
+					child := w.NewCell(PLANT)
 					child.extraData1 = extraData1 - 1
 					child.extraData2 = 1
 					w.SetCell(x, y, child)
@@ -95,45 +109,112 @@ func (w *Worker) UpdatePlant(x, y int) {
 func (w *Worker) UpdateFire(x, y int) {
 	cell := w.GetCell(x, y)
 	if cell.temp < 40 || cell.extraData2 > 60 {
-		if rand.Intn(10) > 1 {
+		if w.rand.Intn(10) > 1 {
 			w.SetCell(x, y, nil)
 		} else {
-			smk := NewCell(SMOKE)
+			smk := w.NewCell(SMOKE)
 			smk.extraData1 = 0
-			smk.extraData2 = 30 + (rand.Intn(30) + -15)
+			smk.extraData2 = 30 + (w.rand.Intn(30) + -15)
 			w.SetCell(x, y, smk)
 		}
 	}
-	if w.InBounds(x, y+1) {
-		other := w.GetCell(x, y+1)
-		if !isEmpty(other) && other.IsFlamable() && rand.Intn(100) > 65 {
-			w.SetCell(x, y+1, NewCell(FIRE))
-			w.SetCell(x, y, nil)
+}
+
+// UpdateAcid dissolves a solid neighbour, depending on its resistance. Every
+// dissolved cell spends the acid a bit and gives off smoke now and then.
+func (w *Worker) UpdateAcid(x, y int) {
+	cell := w.GetCell(x, y)
+	for _, dir := range directions {
+		nx, ny := x+dir[0], y+dir[1]
+		if !w.InBounds(nx, ny) {
+			continue
+		}
+		other := w.GetCell(nx, ny)
+		if isEmpty(other) || other.CType == ACID {
+			continue
+		}
+		m := other.Material()
+		if m.Movement == Liquid || m.Movement == Gas {
+			continue
+		}
+		if w.rand.Float64() >= AcidStrength*(1-m.Resistance) {
+			continue
+		}
+
+		if w.rand.Intn(3) == 0 {
+			w.SetCell(nx, ny, w.NewCell(SMOKE))
+		} else {
+			w.SetCell(nx, ny, nil)
+		}
+		cell.extraData1--
+		if cell.extraData1 <= 0 {
+			w.SetCell(x, y, w.NewCell(SMOKE))
 		}
+		return
 	}
-	if w.InBounds(x, y-1) {
-		other := w.GetCell(x, y-1)
-		if !isEmpty(other) && other.IsFlamable() && rand.Intn(100) > 65 {
-			w.SetCell(x, y-1, NewCell(FIRE))
-			w.SetCell(x, y, nil)
+}
+
+// UpdateOil burns oil touching fire or lava for OilBurnTime ticks, throwing
+// flames into the free cells around it and setting the oil next to it on
+// fire.
+func (w *Worker) UpdateOil(x, y int) {
+	cell := w.GetCell(x, y)
+	burning := cell.extraData1 > 0
+	if !burning && cell.temp >= OilIgnitionTemp {
+		cell.extraData1 = OilBurnTime
+	}
+
+	for _, dir := range directions {
+		nx, ny := x+dir[0], y+dir[1]
+		if !w.InBounds(nx, ny) {
+			continue
+		}
+		other := w.GetCell(nx, ny)
+		switch {
+		case !burning && (cellType(other) == FIRE || cellType(other) == LAVA):
+			cell.extraData1 = OilBurnTime
+		case burning && isEmpty(other) && w.rand.Intn(4) == 0:
+			w.SetCell(nx, ny, w.NewCell(FIRE))
+		case burning && cellType(other) == OIL && other.extraData1 == 0 && w.rand.Intn(10) == 0:
+			w.EditCell(nx, ny, ignite)
+			w.keepAlive(nx, ny)
 		}
 	}
-	if w.InBounds(x+1, y) {
-		other := w.GetCell(x+1, y)
-		if !isEmpty(other) && other.IsFlamable() && rand.Intn(100) > 65 {
-			w.SetCell(x+1, y, NewCell(FIRE))
-			w.SetCell(x, y, nil)
+
+	if burning {
+		cell.extraData1--
+		if cell.extraData1 == 0 {
+			w.SetCell(x, y, w.NewCell(FIRE))
 		}
 	}
-	if w.InBounds(x-1, y) {
-		other := w.GetCell(x-1, y)
-		if !isEmpty(other) && other.IsFlamable() && rand.Intn(100) > 65 {
-			w.SetCell(x-1, y, NewCell(FIRE))
-			w.SetCell(x, y, nil)
+}
+
+// UpdateIce takes IceChill heat from every warmer neighbour, warming the ice
+// up by as much heat, so the total is kept whatever the heat capacities.
+func (w *Worker) UpdateIce(x, y int) {
+	cell := w.GetCell(x, y)
+	for _, dir := range directions {
+		nx, ny := x+dir[0], y+dir[1]
+		if !w.InBounds(nx, ny) {
+			continue
+		}
+		if other := w.GetCell(nx, ny); !isEmpty(other) && other.temp > cell.temp {
+			w.EditCell(nx, ny, chill)
+			cell.temp += IceChill / cell.Material().HeatCapacity
 		}
 	}
 }
 
+// ignite sets oil on fire.
+func ignite(c *Cell) {
+	c.extraData1 = OilBurnTime
+}
+
+// chill takes the heat ice takes from a neighbour.
+func chill(c *Cell) {
+	c.temp -= IceChill / c.Material().HeatCapacity
+}
+
 func (w *Worker) UpdateSmoke(x, y int) {
 	cell := w.GetCell(x, y)
 
@@ -147,36 +228,6 @@ func (w *Worker) UpdateSmoke(x, y int) {
 	}
 }
 
-func (w *Worker) UpdateWater(x, y int) {
-	cell := w.GetCell(x, y)
-
-	if cell.temp >= 100 {
-		t := misc.Clamp(float64(cell.temp/150), 0, 1)
-		chance := (1-t)*0.3 + t*0.7
-		if rand.Intn(100) > int(chance) {
-			w.SetCell(x, y, NewCell(STEAM))
-		}
-	}
-
-	y2 := y + 1
-	for {
-		if !w.InBounds(x, y2) {
-			return
-		}
-		cellBelow := w.GetCell(x, y2)
-		if !isEmpty(cellBelow) && cellBelow.CType == SAND {
-			if cellBelow.extraData1 == 0 {
-				w.SetCell(x, y, nil)
-				cellBelow.extraData1 = 1
-				return
-			}
-		} else {
-			return
-		}
-		y2++
-	}
-}
-
 func (w *Worker) MoveFire(x, y int, cell *Cell) {
 	nx, ny := w.MoveGas(x, y, cell)
 	if other := w.GetCell(nx, ny); !isEmpty(other) {
@@ -190,59 +241,63 @@ func (w *Worker) MoveFire(x, y int, cell *Cell) {
 	}
 }
 
-func (w *Worker) UpdateSand(x, y int) {
-	cell := w.GetCell(x, y)
-	if !isEmpty(cell) && cell.extraData1 == 1 && cell.temp >= 30 {
-		cell.extraData1 = 0
+func (w *Worker) MovePowder(x, y int, cell *Cell) {
+	w.pushCell(x, y, cell)
+	if w.fall(x, y, cell) {
+		return
 	}
-
-	if cell.temp >= 120 {
-		w.SetCell(x, y, NewCell(GLASS))
+	if xn, yn, ok := w.randomNeighbour(x, y, 1, cell); ok {
+		w.MoveCell(x, y, xn, yn)
 	}
 }
 
-func (w *Worker) MovePowder(x, y int, cell *Cell) {
-	if w.IsEmpty(x, y+1) {
-		w.MoveCell(x, y, x, y+1)
-	} else {
-		xn, yn := w.randomNeighbour(x, y, 1)
-		if xn != -1 && yn != -1 {
-			w.MoveCell(x, y, xn, yn)
-		}
+func (w *Worker) MoveLiquid(x, y int, cell *Cell) {
+	w.pushCell(x, y, cell)
+	if w.fall(x, y, cell) {
+		return
+	}
+	if xn, yn, ok := w.randomNeighbour(x, y, 1, cell); ok {
+		w.MoveCell(x, y, xn, yn)
+		return
 	}
-}
 
-func (w *Worker) MoveLiquid(x, y int, cell *Cell) {
-	if w.IsEmpty(x, y+1) {
-		w.MoveCell(x, y, x, y+1)
-	} else {
-		xn, yn := w.randomNeighbour(x, y, 1)
-		if xn != -1 && yn != -1 {
+	// Flow sideways, keeping the direction of velX while the way is free.
+	dir := 1.0
+	if cell.velX < 0 || (cell.velX == 0 && w.rand.Intn(2) == 1) {
+		dir = -1
+	}
+	dispersion := float64(misc.Max(1, cell.Material().Dispersion))
+	for i := 0; i < 2; i++ {
+		xn, yn := w.trace(x, y, dir*dispersion, 0, cell)
+		if xn != x {
+			cell.velX = dir * dispersion
 			w.MoveCell(x, y, xn, yn)
-		} else {
-			xn, yn = w.randomNeighbour(x, y, 0)
-			if xn != -1 && yn != -1 {
-				w.MoveCell(x, y, xn, yn)
-			}
+			return
 		}
+		dir = -dir
 	}
+	cell.velX = 0
 }
 
-// TODO: refactor this to return position.
+// MoveGas moves the cell up or sideways, following the pressure first, and
+// returns where it ended.
 func (w *Worker) MoveGas(x, y int, cell *Cell) (int, int) {
-	if w.IsEmpty(x, y-1) && rand.Intn(100) < 50 {
+	if xn, yn, ok := w.expand(x, y, cell); ok {
+		w.MoveCell(x, y, xn, yn)
+		return xn, yn
+	}
+
+	if w.CanDisplace(x, y-1, cell) && w.rand.Intn(100) < 50 {
 		w.MoveCell(x, y, x, y-1)
 		return x, y - 1
 	}
 
-	xn, yn := w.randomNeighbour(x, y, -1)
-	if xn != -1 && yn != -1 {
+	if xn, yn, ok := w.randomNeighbour(x, y, -1, cell); ok {
 		w.MoveCell(x, y, xn, yn)
 		return xn, yn
 	}
 
-	xn, yn = w.randomNeighbour(x, y, 0)
-	if xn != -1 && yn != -1 {
+	if xn, yn, ok := w.randomNeighbour(x, y, 0, cell); ok {
 		w.MoveCell(x, y, xn, yn)
 		return xn, yn
 	}
@@ -251,35 +306,94 @@ func (w *Worker) MoveGas(x, y int, cell *Cell) (int, int) {
 }
 
 func (w *Worker) MoveSolid(x, y int, cell *Cell) {
-	if w.IsEmpty(x, y+1) {
-		w.MoveCell(x, y, x, y+1)
+	w.fall(x, y, cell)
+}
+
+// fall accelerates the cell with gravity and moves it along its velocity. It
+// returns false when the cell can't move.
+func (w *Worker) fall(x, y int, cell *Cell) bool {
+	cell.velY = math.Min(cell.velY+Gravity, TerminalVelocity)
+
+	xn, yn := w.trace(x, y, cell.velX, cell.velY, cell)
+	if xn == x && yn == y {
+		// Cells resting on others lose their momentum, but not the ones
+		// stuck behind a falling cell.
+		if below := w.GetCell(x, y+1); isEmpty(below) || below.velY == 0 {
+			cell.velY = 0
+			if cell.Material().Movement != Liquid {
+				cell.velX *= Friction
+			}
+		}
+		return false
 	}
+	cell.velX *= Drag
+	w.MoveCell(x, y, xn, yn)
+	return true
 }
 
-func (w *Worker) randomNeighbour(x, y, yOffset int) (int, int) {
-	// check if left is air
-	leftFree := false
-	if w.InBounds(x-1, y+yOffset) && w.IsEmpty(x-1, y) && w.IsEmpty(x-1, y+yOffset) {
-		leftFree = true
+// trace follows a velocity from x, y and returns the furthest position the
+// cell can reach this tick. Moving through other cells slows it down.
+func (w *Worker) trace(x, y int, vx, vy float64, cell *Cell) (int, int) {
+	speed := math.Max(math.Abs(vx), math.Abs(vy))
+	steps := int(math.Ceil(speed))
+	xn, yn := x, y
+	for i := 1; i <= steps; i++ {
+		// Scaled so that slow cells still move one cell.
+		px := x + int(math.Round(vx*float64(i)/speed))
+		py := y + int(math.Round(vy*float64(i)/speed))
+		if px == xn && py == yn {
+			continue
+		}
+		if !w.CanDisplace(px, py, cell) {
+			break
+		}
+		xn, yn = px, py
+		if !w.IsEmpty(px, py) {
+			cell.velX = math.Min(math.Abs(cell.velX), 1) * math.Copysign(1, cell.velX)
+			cell.velY = math.Min(cell.velY, 1)
+			break
+		}
 	}
+	return xn, yn
+}
 
-	// check if right is air
-	rightFree := false
-	if w.InBounds(x+1, y+yOffset); w.IsEmpty(x+1, y) && w.IsEmpty(x+1, y+yOffset) {
-		rightFree = true
+// CanDisplace reports whether cell can move to x, y. That is when it's empty,
+// or holds a lighter fluid the cell sinks through. Gases rise through denser
+// gases instead.
+func (w *Worker) CanDisplace(x, y int, cell *Cell) bool {
+	if !w.InBounds(x, y) {
+		return false
 	}
+	other := w.GetCell(x, y)
+	if isEmpty(other) {
+		return true
+	}
+
+	m, o := cell.Material(), other.Material()
+	if m.Movement == Gas {
+		return o.Movement == Gas && o.Density > m.Density
+	}
+	return (o.Movement == Liquid || o.Movement == Gas) && o.Density < m.Density
+}
+
+// randomNeighbour returns the cell beside x, y and yOffset cells down that
+// cell can move to, picked at random if both sides are free, or false if
+// none is.
+func (w *Worker) randomNeighbour(x, y, yOffset int, cell *Cell) (int, int, bool) {
+	leftFree := w.CanDisplace(x-1, y, cell) && w.CanDisplace(x-1, y+yOffset, cell)
+	rightFree := w.CanDisplace(x+1, y, cell) && w.CanDisplace(x+1, y+yOffset, cell)
 
 	if leftFree || rightFree {
 		if leftFree && rightFree {
-			if rand.Intn(2) == 1 {
-				return x - 1, y + yOffset
+			if w.rand.Intn(2) == 1 {
+				return x - 1, y + yOffset, true
 			}
-			return x + 1, y + yOffset
+			return x + 1, y + yOffset, true
 		} else if leftFree {
-			return x - 1, y + yOffset
+			return x - 1, y + yOffset, true
 		} else {
-			return x + 1, y + yOffset
+			return x + 1, y + yOffset, true
 		}
 	}
-	return -1, -1
+	return x, y, false
 }
@@ -0,0 +1,66 @@
+package sandbox
+
+import "testing"
+
+func TestSandSinksInWater(t *testing.T) {
+	s := newTestSandbox(t, 16, 16)
+	walls(s, 2, 2, 4, 12)
+	for x := 2; x <= 4; x++ {
+		for y := 4; y <= 12; y++ {
+			s.SetCell(x, y, s.NewCell(WATER))
+		}
+	}
+	s.SetCell(3, 2, s.NewCell(SAND))
+	for i := 0; i < 200; i++ {
+		s.Update(false)
+	}
+
+	// The sand may have been soaked on its way down.
+	found := false
+	for x := 2; x <= 4; x++ {
+		for y := 2; y <= 12; y++ {
+			switch cellType(s.GetCell(x, y)) {
+			case SAND, MUD:
+				if y != 12 {
+					t.Fatalf("sand at %d, %d, want it at the bottom", x, y)
+				}
+				found = true
+			}
+		}
+	}
+	if !found {
+		t.Fatal("sand is gone")
+	}
+}
+
+func TestOilFloatsOnWater(t *testing.T) {
+	s := newTestSandbox(t, 16, 16)
+	walls(s, 2, 2, 4, 12)
+	for x := 2; x <= 4; x++ {
+		for y := 2; y <= 12; y++ {
+			cType := WATER
+			if y >= 10 {
+				cType = OIL
+			}
+			s.SetCell(x, y, s.NewCell(cType))
+		}
+	}
+	for i := 0; i < 200; i++ {
+		s.Update(false)
+	}
+
+	if n := count(s, OIL); n != 9 {
+		t.Fatalf("%d cells of OIL left, want 9", n)
+	}
+	for x := 2; x <= 4; x++ {
+		for y := 2; y <= 12; y++ {
+			want := WATER
+			if y <= 4 {
+				want = OIL
+			}
+			if got := cellType(s.GetCell(x, y)); got != want {
+				t.Errorf("cell at %d, %d is %s, want %s", x, y, got, want)
+			}
+		}
+	}
+}
@@ -1,15 +1,16 @@
 package sandbox
 
 import (
+	"bytes"
 	"image/color"
 
 	"pgregory.net/rand"
 )
 
-//go:generate stringer -type=CellType
-
 type CellType int
 
+// Built-in materials. They are defined in this order in materials.json so
+// the constants match their CellType in the registry.
 const (
 	SAND CellType = iota
 	GLASS
@@ -23,111 +24,216 @@ const (
 	IRON
 	CLNE
 	PLANT
-	AIR // special type for empty cells. Always last for easy iteration
+	AIR // special type for empty cells
+	MUD
+	ICE
+	LAVA
+	MGLS
+	OIL
+	GUNP
+	C4
+	BTRY
+	SWCH
+	COIL
+	PELT
+	ACID
+	HEATR
+	COOLR
 )
 
-func (cType CellType) Color() color.RGBA {
-	switch cType {
-	case SAND:
-		return color.RGBA{0xc2, 0xb2, 0x80, 0xff} //#c2b280
-	case WATER:
-		return color.RGBA{0x07, 0xa9, 0xbe, 0xff} //#07a9be
-	case WALL:
-		return color.RGBA{0x25, 0x25, 0x25, 0xff} //#252525
-	case STONE:
-		return color.RGBA{0x80, 0x80, 0x80, 0xff} //#808080
-	case SMOKE:
-		return color.RGBA{0x10, 0x10, 0x10, 0xff} //#101010
-	case STEAM:
-		return color.RGBA{0xad, 0xd8, 0xe6, 0xff} //#add8e6
-	case WOOD:
-		return color.RGBA{0xba, 0x8c, 0x63, 0xff} //#ba8c63
-	case FIRE:
-		return color.RGBA{0xf4, 0x4d, 0x2b, 0xff} //#f44d2b
-	case GLASS:
-		return color.RGBA{0x9f, 0xc6, 0xc5, 0xff} //#9FC6C5
-	case IRON:
-		return color.RGBA{0x9c, 0x9c, 0x9c, 0xff} //#9c9c9c
-	case CLNE:
-		return color.RGBA{0xe0, 0xc0, 0x30, 0xff} //#e0c030
-	case PLANT:
-		return color.RGBA{0x14, 0x3d, 0x15, 0xff} //#143d15
-	default:
-		return color.RGBA{0x00, 0x00, 0x00, 0xff} //#000000
+// None marks a missing material, like the neighbour of reactions that don't
+// need one or a phase a material can't turn into.
+const None CellType = -1
+
+// AnyFlamable stands for every flamable material as the neighbour of a
+// reaction, written "flamable" in the material definitions.
+const AnyFlamable CellType = -2
+
+// behaviors are the Go parts of materials, referenced by name from the
+// material definitions.
+var behaviors = map[string]Behavior{
+	"smoke": {
+		Init: func(c *Cell, r *rand.Rand) {
+			c.extraData1 = 90 + (r.Intn(40) + -20)
+			c.extraData2 = 90
+		},
+		Update: (*Worker).UpdateSmoke,
+	},
+	"fire": {
+		Init: func(c *Cell, r *rand.Rand) {
+			c.extraData1 = r.Intn(60)
+		},
+		Move:   (*Worker).MoveFire,
+		Update: (*Worker).UpdateFire,
+	},
+	"clone": {
+		Update: (*Worker).UpdateReplicator,
+	},
+	"explosive": {
+		Update: (*Worker).UpdateExplosive,
+	},
+	"switch": {
+		BaseColor: func(c *Cell) color.RGBA {
+			if c.extraData1 == 1 {
+				return color.RGBA{0x3c, 0xb0, 0x43, 0xff} //#3cb043
+			}
+			return c.CType.Color()
+		},
+		Conducts: func(c *Cell) bool {
+			return c.extraData1 == 1
+		},
+	},
+	"coil": {
+		Update: (*Worker).UpdateCoil,
+	},
+	"peltier": {
+		Update: (*Worker).UpdatePeltier,
+	},
+	"acid": {
+		Init: func(c *Cell, r *rand.Rand) {
+			c.extraData1 = AcidUses
+		},
+		Update: (*Worker).UpdateAcid,
+	},
+	"oil": {
+		BaseColor: func(c *Cell) color.RGBA {
+			if c.extraData1 > 0 {
+				return color.RGBA{0xe2, 0x58, 0x22, 0xff} //#e25822
+			}
+			return c.CType.Color()
+		},
+		Update: (*Worker).UpdateOil,
+	},
+	"ice": {
+		Update: (*Worker).UpdateIce,
+	},
+	"plant": {
+		Init: func(c *Cell, r *rand.Rand) {
+			c.extraData1 = r.Intn(18) + 1
+		},
+		BaseColor: func(c *Cell) color.RGBA {
+			if c.extraData1 < 2 {
+				return color.RGBA{0x06, 0x59, 0x09, 0xff} //#065909
+			}
+			return c.CType.Color()
+		},
+		Move: func(w *Worker, x, y int, c *Cell) {
+			if c.extraData2 == 0 {
+				w.MovePowder(x, y, c)
+			}
+		},
+		Update: (*Worker).UpdatePlant,
+	},
+}
+
+var builtinNames = [...]string{
+	SAND:  "SAND",
+	GLASS: "GLASS",
+	WATER: "WATER",
+	WALL:  "WALL",
+	STONE: "STONE",
+	SMOKE: "SMOKE",
+	STEAM: "STEAM",
+	WOOD:  "WOOD",
+	FIRE:  "FIRE",
+	IRON:  "IRON",
+	CLNE:  "CLNE",
+	PLANT: "PLANT",
+	AIR:   "AIR",
+	MUD:   "MUD",
+	ICE:   "ICE",
+	LAVA:  "LAVA",
+	MGLS:  "MGLS",
+	OIL:   "OIL",
+	GUNP:  "GUNP",
+	C4:    "C4",
+	BTRY:  "BTRY",
+	SWCH:  "SWCH",
+	COIL:  "COIL",
+	PELT:  "PELT",
+	ACID:  "ACID",
+	HEATR: "HEATR",
+	COOLR: "COOLR",
+}
+
+func init() {
+	if err := Materials.Load(bytes.NewReader(defaultMaterials)); err != nil {
+		panic("sandbox: loading default materials: " + err.Error())
+	}
+	for cType, name := range builtinNames {
+		if got, ok := Materials.Lookup(name); !ok || got != CellType(cType) {
+			panic("sandbox: built-in material " + name + " is missing or out of order")
+		}
 	}
 }
 
+func (cType CellType) String() string {
+	return Materials.Get(cType).Name
+}
+
+func (cType CellType) Color() color.RGBA {
+	return Materials.Get(cType).Color
+}
+
 type Cell struct {
 	CType CellType
 
 	colorOffset int
 
-	temp       int
+	temp       float64
 	extraData1 int
 	extraData2 int
+
+	velX, velY float64
+
+	spark sparkState
+
+	// moved is one past the tick the cell last moved in, so it isn't moved
+	// again by the chunk it moved into.
+	moved uint64
 }
 
+// NewCell creates a cell with a randomly seeded state. Cells created by the
+// simulation draw it from the random source of their Worker instead, and
+// painted ones from Sandbox.NewCell, so runs with the same seed stay the
+// same.
 func NewCell(cType CellType) *Cell {
+	return newCell(cType, rand.New())
+}
+
+func newCell(cType CellType, r *rand.Rand) *Cell {
+	m := Materials.Get(cType)
 	cell := &Cell{
 		CType:       cType,
-		colorOffset: rand.Intn(20) + -10,
+		colorOffset: r.Intn(20) + -10,
+		temp:        m.Temperature,
 	}
-	switch cType {
-	case SMOKE:
-		cell.extraData1 = 90 + (rand.Intn(40) + -20)
-		cell.extraData2 = 90
-	case STEAM:
-		cell.temp = 100
-	case FIRE:
-		cell.extraData1 = rand.Intn(60)
-		cell.temp = 130
-	case PLANT:
-		cell.extraData1 = rand.Intn(18) + 1
+	if m.Init != nil {
+		m.Init(cell, r)
 	}
 	return cell
 }
 
+func (c *Cell) Material() *Material {
+	return Materials.Get(c.CType)
+}
+
+// Temp returns the temperature of the cell in degrees Celsius.
+func (c *Cell) Temp() float64 {
+	return c.temp
+}
+
 func (c *Cell) ThermalConductivity() int {
-	switch c.CType {
-	case SAND, CLNE, PLANT:
-		return 3
-	case WATER:
-		return 5
-	case STONE, WOOD:
-		return 1
-	case FIRE, GLASS:
-		return 2
-	case STEAM, SMOKE:
-		return 6
-	case IRON:
-		return 8
-	default:
-		return 0
-	}
+	return c.Material().Conductivity
 }
 
 func (c *Cell) IsFlamable() bool {
-	switch c.CType {
-	case WOOD, PLANT:
-		return true
-	default:
-		return false
-	}
+	return c.Material().Flamable
 }
 
 func (c *Cell) BaseColor() color.RGBA {
-	switch c.CType {
-	case SAND:
-		if c.extraData1 > 0 {
-			return color.RGBA{0xb1, 0x9d, 0x5e, 0xff} //#b19d5e
-		}
-		return c.CType.Color()
-	case PLANT:
-		if c.extraData1 < 2 {
-			return color.RGBA{0x06, 0x59, 0x09, 0xff} //#065909
-		}
-		return c.CType.Color()
-	default:
-		return c.CType.Color()
+	if baseColor := c.Material().BaseColor; baseColor != nil {
+		return baseColor(c)
 	}
+	return c.CType.Color()
 }
@@ -1,21 +1,26 @@
 package sandbox
 
 import (
+	"image"
 	"sort"
-	"sync"
 
 	"github.com/mrmarble/sandbox/pkg/misc"
 	"pgregory.net/rand"
 )
 
+// Change swaps the cell at src in chunk with the one at dst, which is nil
+// for plain moves. The cells are kept to drop changes made stale by others.
 type Change struct {
-	dst, src int
-	chunk    *Chunk
+	dst, src    int
+	chunk       *Chunk
+	cell, other *Cell
 }
 
 type Chunk struct {
 	Width, Height int
 	X, Y          int
+	// left and top are the coordinates of the first cell of the chunk.
+	left, top int
 
 	// Dirty rect
 	MinX, MinY int
@@ -27,19 +32,32 @@ type Chunk struct {
 	filledCells int
 	cells       []*Cell
 	changes     []Change
+	pressure    pressureField
+	sparks      []sparkState
+	heat        []float64
+	rand        *rand.Rand
 
-	filledCellsMutex sync.Mutex
-	changesMutex     sync.Mutex
-	dirtyRectMutex   sync.Mutex
+	// heatAwake is set while the temperatures of the chunk are changing, and
+	// heatRun while its heat is updated this tick.
+	heatAwake, heatRun bool
 }
 
-func NewChunk(width, height, x, y int) *Chunk {
+// NewChunk creates the chunk at x, y covering area.
+func NewChunk(x, y int, area image.Rectangle) *Chunk {
+	width, height := area.Dx(), area.Dy()
 	return &Chunk{
-		Width:  width,
-		Height: height,
-		X:      x,
-		Y:      y,
-		cells:  make([]*Cell, width*height),
+		Width:    width,
+		Height:   height,
+		X:        x,
+		Y:        y,
+		left:     area.Min.X,
+		top:      area.Min.Y,
+		cells:    make([]*Cell, width*height),
+		pressure: newPressureField(width, height),
+		sparks:   make([]sparkState, width*height),
+		heat:     make([]float64, width*height),
+
+		heatAwake: true,
 	}
 }
 
@@ -51,12 +69,15 @@ func (c *Chunk) KeepAliveAt(i int) {
 	x := i % c.Width
 	y := i / c.Width
 
-	c.dirtyRectMutex.Lock()
 	c.minXw = misc.Clamp(misc.Min(x-2, c.minXw), 0, c.Width)
 	c.minYw = misc.Clamp(misc.Min(y-2, c.minYw), 0, c.Height)
 	c.maxXw = misc.Clamp(misc.Max(x+2, c.maxXw), 0, c.Width)
 	c.maxYw = misc.Clamp(misc.Max(y+2, c.maxYw), 0, c.Height)
-	c.dirtyRectMutex.Unlock()
+}
+
+// awake reports whether the cells of the chunk are updated this tick.
+func (c *Chunk) awake() bool {
+	return c.MinX < c.MaxX && c.MinY < c.MaxY
 }
 
 func (c *Chunk) UpdateRect() {
@@ -73,16 +94,17 @@ func (c *Chunk) UpdateRect() {
 
 // GetIndex returns the index of the cell at the given coordinates.
 func (c *Chunk) GetIndex(x, y int) int {
-	return (x - c.X*c.Width) + (y-c.Y*c.Height)*c.Width
+	return (x - c.left) + (y-c.top)*c.Width
 }
 
 func (c *Chunk) InBounds(x, y int) bool {
-	left := c.X * c.Width
-	right := left + c.Width
-	top := c.Y * c.Height
-	bottom := top + c.Height
-	return x >= left && x < right &&
-		y >= top && y < bottom
+	return x >= c.left && x < c.left+c.Width &&
+		y >= c.top && y < c.top+c.Height
+}
+
+// Bounds returns the area of the sandbox the chunk covers.
+func (c *Chunk) Bounds() image.Rectangle {
+	return image.Rect(c.left, c.top, c.left+c.Width, c.top+c.Height)
 }
 
 func (c *Chunk) IsEmpty(x, y int) bool {
@@ -111,51 +133,69 @@ func isEmpty(cell *Cell) bool {
 
 func (c *Chunk) SetCellAt(i int, cell *Cell) {
 	if isEmpty(c.cells[i]) && !isEmpty(cell) {
-		c.filledCellsMutex.Lock()
 		c.filledCells++
-		c.filledCellsMutex.Unlock()
 	} else if !isEmpty(c.cells[i]) && isEmpty(cell) {
-		c.filledCellsMutex.Lock()
 		c.filledCells--
-		c.filledCellsMutex.Unlock()
 	}
 	c.cells[i] = cell
 	c.KeepAliveAt(i)
 }
 
+// MoveCell queues the move of the cell at x, y in src to dx, dy in c. Like
+// every change to a chunk, only its worker can queue moves during an update.
 func (c *Chunk) MoveCell(src *Chunk, x, y, dx, dy int) {
-	c.changesMutex.Lock()
-	c.changes = append(c.changes, Change{dst: c.GetIndex(dx, dy), src: src.GetIndex(x, y), chunk: src})
-	c.changesMutex.Unlock()
+	change := Change{
+		dst:   c.GetIndex(dx, dy),
+		src:   src.GetIndex(x, y),
+		chunk: src,
+		cell:  src.GetCell(x, y),
+		other: c.GetCell(dx, dy),
+	}
+	c.changes = append(c.changes, change)
+}
+
+// isStale reports whether the cells of the change moved since it was queued.
+func (c *Chunk) isStale(change Change) bool {
+	return change.chunk.GetCellAt(change.src) != change.cell || c.GetCellAt(change.dst) != change.other
 }
 
 func (c *Chunk) ApplyChanges() {
-	// remove changes that have the destination cell occupied
+	// remove changes whose cells have already been moved
 	for i := 0; i < len(c.changes); i++ {
-		if !c.IsEmptyAt(c.changes[i].dst) {
+		if c.isStale(c.changes[i]) {
 			c.changes = append(c.changes[:i], c.changes[i+1:]...)
 			i--
 		}
 	}
 
-	// sort changes by destination index
+	// sort changes by destination, then by source, as they are queued in
+	// whatever order the chunks run
 	sort.Slice(c.changes, func(i, j int) bool {
-		return c.changes[i].dst < c.changes[j].dst
+		a, b := c.changes[i], c.changes[j]
+		if a.dst != b.dst {
+			return a.dst < b.dst
+		}
+		if a.chunk.Y != b.chunk.Y {
+			return a.chunk.Y < b.chunk.Y
+		}
+		if a.chunk.X != b.chunk.X {
+			return a.chunk.X < b.chunk.X
+		}
+		return a.src < b.src
 	})
 
 	// pick random source for each destination
 	iPrev := 0
-	c.changes = append(c.changes, Change{-1, -1, nil}) // catch the last one
+	c.changes = append(c.changes, Change{dst: -1, src: -1}) // catch the last one
 	for i := 0; i < len(c.changes)-1; i++ {
 		if c.changes[i+1].dst != c.changes[i].dst {
-			rng := rand.Intn(i-iPrev+1) + iPrev
-
-			dst := c.changes[rng].dst
-			src := c.changes[rng].src
-			chunk := c.changes[rng].chunk
+			rng := c.rand.Intn(i-iPrev+1) + iPrev
+			change := c.changes[rng]
 
-			c.SetCellAt(dst, chunk.GetCellAt(src))
-			chunk.SetCellAt(src, nil)
+			if !c.isStale(change) {
+				c.SetCellAt(change.dst, change.cell)
+				change.chunk.SetCellAt(change.src, change.other)
+			}
 
 			iPrev = i + 1
 		}
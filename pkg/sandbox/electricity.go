@@ -0,0 +1,137 @@
+package sandbox
+
+import "github.com/mrmarble/sandbox/pkg/misc"
+
+type sparkState uint8
+
+// Sparks travel through conductors as a head followed by a tail, which keeps
+// them from flowing back the way they came.
+const (
+	sparkIdle sparkState = iota
+	sparkHead
+	sparkTail
+)
+
+const (
+	// CoilHeat is the heat a powered COIL cell gains every tick.
+	CoilHeat = 20
+	// CoilMaxTemp is the temperature COIL stops heating at.
+	CoilMaxTemp = 600
+	// PeltierCooling is the heat a powered PELT cell loses every tick.
+	PeltierCooling = 10
+	// PeltierMinTemp is the temperature PELT stops cooling at.
+	PeltierMinTemp = -200
+)
+
+// Conducts reports whether electricity flows through the cell.
+func (c *Cell) Conducts() bool {
+	m := c.Material()
+	if m.Conducts != nil {
+		return m.Conducts(c)
+	}
+	return m.Conductive
+}
+
+// Powered reports whether a spark is going through the cell.
+func (c *Cell) Powered() bool {
+	return c.spark == sparkHead
+}
+
+// sparking reports whether the cell sparks its neighbours.
+func (c *Cell) sparking() bool {
+	return !isEmpty(c) && (c.spark == sparkHead || c.Material().PowerSource)
+}
+
+// ElectricUpdate moves sparks one cell through the conductors. Every chunk
+// computes the next state of its cells from the current ones before any is
+// changed, so the result doesn't depend on the order chunks are run in.
+func (s *Sandbox) ElectricUpdate() {
+	poolMutex.Lock()
+	defer poolMutex.Unlock()
+	pool.each(s, s.Chunks, (*Worker).UpdateChunkSparks)
+	pool.each(s, s.Chunks, func(w *Worker) {
+		w.chunk.applySparks()
+	})
+}
+
+func (w *Worker) UpdateChunkSparks() {
+	c := w.chunk
+	for i, cell := range c.cells {
+		c.sparks[i] = sparkIdle
+		if isEmpty(cell) || !cell.Conducts() || cell.Material().PowerSource {
+			continue
+		}
+		switch cell.spark {
+		case sparkHead:
+			c.sparks[i] = sparkTail
+		case sparkTail:
+			c.sparks[i] = sparkIdle
+		default:
+			x := i%c.Width + c.left
+			y := i/c.Width + c.top
+			for _, dir := range directions {
+				if w.GetCell(x+dir[0], y+dir[1]).sparking() {
+					c.sparks[i] = sparkHead
+					break
+				}
+			}
+		}
+	}
+}
+
+func (c *Chunk) applySparks() {
+	for i, cell := range c.cells {
+		if isEmpty(cell) || cell.spark == c.sparks[i] {
+			continue
+		}
+		cell.spark = c.sparks[i]
+		c.KeepAliveAt(i)
+	}
+}
+
+// Toggle flips the switch at x, y, along with the switch cells connected to
+// it.
+func (s *Sandbox) Toggle(x, y int) {
+	if !s.InBounds(x, y) {
+		return
+	}
+	cell := s.GetCell(x, y)
+	if isEmpty(cell) || cell.CType != SWCH {
+		return
+	}
+	state := cell.extraData1
+	queue := [][2]int{{x, y}}
+	for len(queue) > 0 {
+		x, y := queue[0][0], queue[0][1]
+		queue = queue[1:]
+		if !s.InBounds(x, y) {
+			continue
+		}
+		cell := s.GetCell(x, y)
+		if isEmpty(cell) || cell.CType != SWCH || cell.extraData1 != state {
+			continue
+		}
+		cell.extraData1 = 1 - state
+		cell.spark = sparkIdle
+		s.KeepAlive(x, y)
+		for _, dir := range directions {
+			queue = append(queue, [2]int{x + dir[0], y + dir[1]})
+		}
+	}
+}
+
+// UpdateCoil heats the cell while powered.
+func (w *Worker) UpdateCoil(x, y int) {
+	cell := w.GetCell(x, y)
+	if cell.Powered() {
+		cell.temp = misc.Max(cell.temp, misc.Min(cell.temp+CoilHeat, CoilMaxTemp))
+	}
+}
+
+// UpdatePeltier cools the cell while powered.
+func (w *Worker) UpdatePeltier(x, y int) {
+	cell := w.GetCell(x, y)
+	if cell.Powered() {
+		cell.temp = misc.Min(cell.temp, misc.Max(cell.temp-PeltierCooling, PeltierMinTemp))
+	}
+}
@@ -0,0 +1,140 @@
+package sandbox
+
+import (
+	"math"
+	"sort"
+
+	"github.com/mrmarble/sandbox/pkg/misc"
+)
+
+// DetonationTemp is the temperature at which explosives go off on their own.
+const DetonationTemp = 200
+
+type explosion struct {
+	x, y   int
+	radius int
+	power  float64
+}
+
+// UpdateExplosive detonates the cell when it touches fire or gets too hot.
+func (w *Worker) UpdateExplosive(x, y int) {
+	cell := w.GetCell(x, y)
+	ignited := cell.temp >= DetonationTemp
+	for _, dir := range directions {
+		if ignited {
+			break
+		}
+		nx, ny := x+dir[0], y+dir[1]
+		if w.InBounds(nx, ny) {
+			ignited = cellType(w.GetCell(nx, ny)) == FIRE
+		}
+	}
+	if ignited {
+		m := cell.Material()
+		w.sandbox.Detonate(x, y, m.BlastRadius, m.BlastPower)
+	}
+}
+
+// Detonate queues an explosion at x, y. Explosions are applied after the
+// parallel passes, so they can reach any chunk safely.
+func (s *Sandbox) Detonate(x, y, radius int, power float64) {
+	s.explosionsMutex.Lock()
+	s.explosions = append(s.explosions, explosion{x, y, radius, power})
+	s.explosionsMutex.Unlock()
+}
+
+// applyExplosions runs the queued explosions, including the ones they set off.
+// They are sorted first, as they are queued in whatever order the chunks run.
+func (s *Sandbox) applyExplosions() {
+	sort.Slice(s.explosions, func(i, j int) bool {
+		a, b := s.explosions[i], s.explosions[j]
+		if a.y != b.y {
+			return a.y < b.y
+		}
+		return a.x < b.x
+	})
+	// Explosives set off by several blasts explode once.
+	queued := make(map[[2]int]bool, len(s.explosions))
+	for _, e := range s.explosions {
+		queued[[2]int{e.x, e.y}] = true
+	}
+	for len(s.explosions) > 0 {
+		e := s.explosions[0]
+		s.explosions = s.explosions[1:]
+		s.explode(e, queued)
+	}
+}
+
+// explode clears the cells within the blast radius into fire and smoke, and
+// heats and flings the ones up to twice as far. Static materials that don't
+// burn, like walls, survive the blast. Explosives already gone, because an
+// earlier explosion of the same tick cleared them, are skipped. Explosives
+// within reach are set off, unless they are already in queued.
+func (s *Sandbox) explode(e explosion, queued map[[2]int]bool) {
+	cell := s.GetCell(e.x, e.y)
+	if isEmpty(cell) || cell.Material().BlastRadius == 0 {
+		return
+	}
+	s.SetCell(e.x, e.y, nil)
+	s.AddPressure(e.x, e.y, e.power)
+
+	reach := e.radius * 2
+	for y := e.y - reach; y <= e.y+reach; y++ {
+		for x := e.x - reach; x <= e.x+reach; x++ {
+			dist := math.Hypot(float64(x-e.x), float64(y-e.y))
+			if dist > float64(reach) {
+				continue
+			}
+			chunk := s.GetChunk(x, y)
+			if chunk == nil {
+				continue
+			}
+			cell := chunk.GetCell(x, y)
+			falloff := 1 - dist/float64(reach)
+
+			if !isEmpty(cell) {
+				m := cell.Material()
+				if m.BlastRadius > 0 {
+					if p := [2]int{x, y}; !queued[p] {
+						queued[p] = true
+						s.explosions = append(s.explosions, explosion{x, y, m.BlastRadius, m.BlastPower})
+					}
+					continue
+				}
+				if m.Movement == Static && !m.Flamable {
+					cell.temp += e.power * 10 * falloff
+					chunk.heatAwake = true
+					continue
+				}
+			}
+
+			if dist <= float64(e.radius) {
+				chunk.SetCell(x, y, s.blastCell())
+				continue
+			}
+			if isEmpty(cell) {
+				continue
+			}
+			cell.temp += e.power * 10 * falloff
+			chunk.heatAwake = true
+			if dist > 0 {
+				speed := e.power * falloff
+				cell.velX = misc.Clamp(cell.velX+speed*float64(x-e.x)/dist, -TerminalVelocity, TerminalVelocity)
+				cell.velY = misc.Clamp(cell.velY+speed*float64(y-e.y)/dist, -TerminalVelocity, TerminalVelocity)
+			}
+			chunk.KeepAlive(x, y)
+		}
+	}
+}
+
+// blastCell returns what fills a cell cleared by an explosion.
+func (s *Sandbox) blastCell() *Cell {
+	switch n := s.rand.Intn(10); {
+	case n < 4:
+		return s.NewCell(FIRE)
+	case n < 6:
+		return s.NewCell(SMOKE)
+	default:
+		return nil
+	}
+}
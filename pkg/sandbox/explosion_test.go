@@ -0,0 +1,20 @@
+package sandbox
+
+import "testing"
+
+func TestExplosivesExplodeOnce(t *testing.T) {
+	s := newTestSandbox(t, 256, 128)
+	for x := 20; x < 220; x++ {
+		for y := 40; y < 90; y++ {
+			s.SetCell(x, y, s.NewCell(C4))
+		}
+	}
+	s.Detonate(20, 40, Materials.Get(C4).BlastRadius, Materials.Get(C4).BlastPower)
+
+	// Every explosive of the slab is set off by dozens of blasts, but must
+	// only be queued once.
+	s.applyExplosions()
+	if n := count(s, C4); n != 0 {
+		t.Fatalf("%d cells of C4 left", n)
+	}
+}
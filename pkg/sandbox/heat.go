@@ -0,0 +1,161 @@
+package sandbox
+
+import "math"
+
+const (
+	// MaxConductivity is the highest conductivity of a material.
+	MaxConductivity = 8
+	// HeatDivisor scales down the heat flowing between two cells. It must be
+	// at least 16 times MaxConductivity for the diffusion to be stable, with
+	// heat capacities of at least 1.
+	HeatDivisor = 128
+	// DefaultAmbientRate is the fraction of the difference with the ambient
+	// temperature lost every tick by new sandboxes.
+	DefaultAmbientRate = 0.002
+	// MinTempChange is the smallest temperature change that keeps a cell
+	// awake.
+	MinTempChange = 0.01
+)
+
+// TempUpdate spreads heat between touching cells. Every chunk computes the
+// heat of its cells from the current temperatures before any is changed, and
+// the heat leaving a cell is the heat entering its neighbour, so the total
+// heat is kept whatever order the chunks are run in. Cells then relax toward
+// the ambient temperature, unless the ambient rate is 0.
+//
+// Only the chunks whose heat is awake, or whose cells are, and the chunks
+// around them are updated, and heat only flows between updated chunks, so the
+// chunks left out keep theirs.
+func (s *Sandbox) TempUpdate() {
+	poolMutex.Lock()
+	defer poolMutex.Unlock()
+	chunks := s.heatChunks()
+	pool.each(s, chunks, (*Worker).UpdateChunkTemp)
+	pool.each(s, chunks, func(w *Worker) {
+		w.chunk.applyHeat()
+		w.UpdateChunkAmbient()
+	})
+}
+
+// heatChunks marks and returns the chunks whose heat is updated this tick,
+// in the order of s.Chunks.
+func (s *Sandbox) heatChunks() []*Chunk {
+	for _, c := range s.Chunks {
+		c.heatRun = false
+	}
+	for _, c := range s.Chunks {
+		if !c.heatAwake && !c.awake() {
+			continue
+		}
+		for y := c.Y - 1; y <= c.Y+1; y++ {
+			for x := c.X - 1; x <= c.X+1; x++ {
+				if other := s.chunkLookup[[2]int{x, y}]; other != nil {
+					other.heatRun = true
+				}
+			}
+		}
+	}
+	s.heatRun = s.heatRun[:0]
+	for _, c := range s.Chunks {
+		if c.heatRun {
+			s.heatRun = append(s.heatRun, c)
+		}
+	}
+	return s.heatRun
+}
+
+// wakeHeat updates the heat of every chunk on the next tick.
+func (s *Sandbox) wakeHeat() {
+	for _, c := range s.Chunks {
+		c.heatAwake = true
+	}
+}
+
+// UpdateChunkTemp computes the heat of every cell of the chunk after
+// exchanging heat with its neighbours. Whole chunks are updated, as a cell
+// skipped on one side of an exchange would make heat out of nothing. The heat
+// of the chunk goes to sleep once its cells are within MinTempChange of the
+// neighbours they exchange heat with and of the ambient temperature.
+func (w *Worker) UpdateChunkTemp() {
+	c := w.chunk
+	ambient, relax := w.sandbox.ambient, w.sandbox.ambientRate > 0
+	settled := true
+	for i, cell := range c.cells {
+		if isEmpty(cell) {
+			continue
+		}
+		if relax && !cell.Material().FixedTemperature && math.Abs(cell.temp-ambient) >= MinTempChange {
+			settled = false
+		}
+		heat := cell.Heat()
+		x := i%c.Width + c.left
+		y := i/c.Width + c.top
+		for _, dir := range directions {
+			nx, ny := x+dir[0], y+dir[1]
+			other := w.GetCell(nx, ny)
+			if isEmpty(other) {
+				continue
+			}
+			if settled && math.Abs(cell.temp-other.temp) >= MinTempChange && cell.ThermalConductivity()+other.ThermalConductivity() > 0 {
+				settled = false
+			}
+			if c.InBounds(nx, ny) || w.chunkAt(nx, ny).heatRun {
+				heat -= heatFlow(cell, other)
+			}
+		}
+		c.heat[i] = heat
+	}
+	c.heatAwake = !settled
+}
+
+// heatFlow returns the heat going from a to b, the exact opposite of the
+// heat going from b to a.
+func heatFlow(a, b *Cell) float64 {
+	return (a.temp - b.temp) * float64(a.ThermalConductivity()+b.ThermalConductivity()) / HeatDivisor
+}
+
+// Heat returns the heat held by the cell, its temperature times the heat
+// capacity of its material.
+func (c *Cell) Heat() float64 {
+	return c.temp * c.Material().HeatCapacity
+}
+
+func (c *Chunk) applyHeat() {
+	for i, cell := range c.cells {
+		if isEmpty(cell) {
+			continue
+		}
+		temp := c.heat[i] / cell.Material().HeatCapacity
+		if math.Abs(temp-cell.temp) >= MinTempChange {
+			c.KeepAliveAt(i)
+		}
+		cell.temp = temp
+	}
+}
+
+// UpdateChunkAmbient relaxes the temperature of the cells toward the ambient
+// temperature and brings the ones with a fixed temperature back to it.
+func (w *Worker) UpdateChunkAmbient() {
+	ambient, rate := w.sandbox.ambient, w.sandbox.ambientRate
+	for i, c := range w.chunk.cells {
+		if isEmpty(c) {
+			continue
+		}
+		if m := c.Material(); m.FixedTemperature {
+			c.temp = m.Temperature
+			continue
+		}
+		if rate == 0 {
+			continue
+		}
+		if math.Abs(ambient-c.temp) < MinTempChange {
+			c.temp = ambient
+			continue
+		}
+		diff := (ambient - c.temp) * rate
+		c.temp += diff
+		if math.Abs(diff) >= MinTempChange {
+			w.chunk.KeepAliveAt(i)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package sandbox
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// totalHeat returns the heat held by all the cells of s.
+func totalHeat(s *Sandbox) float64 {
+	heat := 0.0
+	for _, c := range s.Chunks {
+		for _, cell := range c.cells {
+			if !isEmpty(cell) {
+				heat += cell.Heat()
+			}
+		}
+	}
+	return heat
+}
+
+func TestClosedBoxKeepsHeat(t *testing.T) {
+	s := newTestSandbox(t, 160, 100)
+	s.SetAmbientRate(0)
+	// A box across chunks, half hot iron and half cold stone, surrounded by
+	// nothing to give heat to.
+	walls(s, 40, 30, 120, 70)
+	for x := 40; x <= 120; x++ {
+		for y := 30; y <= 70; y++ {
+			cell := s.NewCell(STONE)
+			if x < 80 {
+				cell = s.NewCell(IRON)
+				cell.temp = 600
+			}
+			s.SetCell(x, y, cell)
+		}
+	}
+
+	want := totalHeat(s)
+	for i := 0; i < 500; i++ {
+		s.Update(true)
+	}
+	if got := totalHeat(s); math.Abs(got-want) > want*1e-9 {
+		t.Fatalf("total heat went from %g to %g", want, got)
+	}
+	if temp := s.GetCell(85, 50).temp; temp < 1 {
+		t.Fatalf("the heat didn't spread, the stone is at %g", temp)
+	}
+}
+
+func TestAmbientRelaxation(t *testing.T) {
+	s := newTestSandbox(t, 16, 16)
+	s.SetAmbient(20)
+	walls(s, 2, 2, 2, 2)
+	iron := s.NewCell(IRON)
+	iron.temp = 600
+	s.SetCell(2, 2, iron)
+	for i := 0; i < 100; i++ {
+		s.Update(true)
+	}
+	if got := totalHeat(s); got >= 600*Materials.Get(IRON).HeatCapacity {
+		t.Fatalf("the box didn't cool down, holding %g", got)
+	}
+}
+
+func TestHeatCapacityBelowOne(t *testing.T) {
+	err := Materials.Load(strings.NewReader(`[
+		{"name": "FOAM", "color": "#ffffff", "heatCapacity": 0.5, "movement": "static"}
+	]`))
+	if err == nil {
+		t.Fatal("loaded a heat capacity below 1")
+	}
+}
+
+func TestIceKeepsHeat(t *testing.T) {
+	s := newTestSandbox(t, 32, 32)
+	s.SetAmbientRate(0)
+	// A block of ice in water, too warm to freeze the water and too cold to
+	// melt, as changing phase changes the heat capacity.
+	walls(s, 8, 8, 23, 23)
+	for x := 8; x <= 23; x++ {
+		for y := 8; y <= 23; y++ {
+			cell := s.NewCell(WATER)
+			cell.temp = -60
+			if x >= 12 && x < 20 && y >= 12 && y < 20 {
+				cell = s.NewCell(ICE)
+				cell.temp = -84
+			}
+			s.SetCell(x, y, cell)
+		}
+	}
+
+	want := totalHeat(s)
+	for i := 0; i < 2; i++ {
+		s.Update(true)
+	}
+	if n := count(s, ICE); n != 64 {
+		t.Fatalf("%d of 64 ice cells are left", n)
+	}
+	if got := totalHeat(s); math.Abs(got-want) > math.Abs(want)*1e-9 {
+		t.Fatalf("total heat went from %g to %g", want, got)
+	}
+}
+
+func TestHeatSleeps(t *testing.T) {
+	s := newTestSandbox(t, 3*DefaultChunkSize, DefaultChunkSize)
+	s.SetAmbientRate(0)
+	// A slab of stone across three chunks, all at the same temperature.
+	for x := 0; x < 3*DefaultChunkSize; x++ {
+		for y := 40; y < DefaultChunkSize; y++ {
+			s.SetCell(x, y, s.NewCell(STONE))
+		}
+	}
+	for i := 0; i < 5; i++ {
+		s.Update(true)
+	}
+	if n := len(s.heatChunks()); n != 0 {
+		t.Fatalf("the heat of %d chunks is updated in a settled slab", n)
+	}
+
+	// Hot iron on the edge of the middle chunk heats the sleeping chunk
+	// beside it, keeping the total heat.
+	iron := s.NewCell(IRON)
+	iron.temp = 600
+	s.SetCell(2*DefaultChunkSize-1, 50, iron)
+	want := totalHeat(s)
+	for i := 0; i < 100; i++ {
+		s.Update(true)
+	}
+	if got := totalHeat(s); math.Abs(got-want) > want*1e-9 {
+		t.Fatalf("total heat went from %g to %g", want, got)
+	}
+	if temp := s.GetCell(2*DefaultChunkSize, 50).temp; temp < 1 {
+		t.Fatalf("the heat didn't reach the next chunk, its stone is at %g", temp)
+	}
+}
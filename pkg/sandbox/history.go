@@ -0,0 +1,162 @@
+package sandbox
+
+import "unsafe"
+
+// DefaultHistoryBudget is the memory, in bytes, the game lets its history
+// use.
+const DefaultHistoryBudget = 64 << 20
+
+// History keeps the edits made to a sandbox, the strokes painted on it and
+// the sandboxes it replaced, so they can be undone and redone. The oldest
+// edits are forgotten once they use more memory than the budget.
+//
+// Undoing puts back the cells a stroke replaced, wherever the simulation has
+// moved things since.
+type History struct {
+	budget int
+	size   int
+
+	undo, redo []*edit
+
+	// open is set while the last edit can still be extended by a stroke.
+	open bool
+}
+
+// edit is either the cells replaced by a stroke or a replaced sandbox.
+// Applying it swaps them with the current ones, so the same edit undoes and
+// redoes.
+type edit struct {
+	cells   []editCell
+	sandbox *Sandbox
+
+	// bytes is the memory the edit uses at most.
+	bytes int
+}
+
+type editCell struct {
+	x, y int
+	cell *Cell
+}
+
+func NewHistory(budget int) *History {
+	return &History{budget: budget}
+}
+
+// Paint paints on s like Sandbox.Paint, keeping the cells it replaces. A
+// stroke that doesn't begin a new edit is undone along with the previous
+// ones, so a whole drag of the brush is undone at once.
+func (h *History) Paint(s *Sandbox, x0, y0, x1, y1, size int, cType CellType, begin bool) {
+	if begin {
+		h.open = false
+	}
+	s.paint(x0, y0, x1, y1, size, cType, func(x, y int, old *Cell) {
+		if !h.open {
+			h.push(&edit{})
+			h.open = true
+		}
+		e := h.undo[len(h.undo)-1]
+		e.cells = append(e.cells, editCell{x, y, old})
+		e.bytes += cellEditSize
+		h.size += cellEditSize
+	})
+	h.trim()
+}
+
+// Replace records that s was replaced by another sandbox.
+func (h *History) Replace(s *Sandbox) {
+	h.open = false
+	h.push(&edit{sandbox: s, bytes: s.memSize()})
+	h.trim()
+}
+
+// Undo undoes the last edit on s, and returns the sandbox to use from now
+// on.
+func (h *History) Undo(s *Sandbox) *Sandbox {
+	h.open = false
+	if len(h.undo) == 0 {
+		return s
+	}
+	e := h.undo[len(h.undo)-1]
+	h.undo = h.undo[:len(h.undo)-1]
+	h.redo = append(h.redo, e)
+	return h.apply(e, s, true)
+}
+
+// Redo redoes the last undone edit on s, and returns the sandbox to use from
+// now on.
+func (h *History) Redo(s *Sandbox) *Sandbox {
+	h.open = false
+	if len(h.redo) == 0 {
+		return s
+	}
+	e := h.redo[len(h.redo)-1]
+	h.redo = h.redo[:len(h.redo)-1]
+	h.undo = append(h.undo, e)
+	return h.apply(e, s, false)
+}
+
+// apply applies e to s, keeping the size of the history up to date with the
+// sandbox e may now hold instead.
+func (h *History) apply(e *edit, s *Sandbox, undo bool) *Sandbox {
+	h.size -= e.bytes
+	s = e.apply(s, undo)
+	h.size += e.bytes
+	h.trim()
+	return s
+}
+
+// push adds a new edit, which can't be redone past.
+func (h *History) push(e *edit) {
+	for _, r := range h.redo {
+		h.size -= r.bytes
+	}
+	h.redo = nil
+	h.undo = append(h.undo, e)
+	h.size += e.bytes
+}
+
+// trim forgets the oldest edits, then the farthest undone ones, until the
+// history fits its budget, always keeping the last edit done.
+func (h *History) trim() {
+	for h.size > h.budget && len(h.undo) > 1 {
+		h.size -= h.undo[0].bytes
+		h.undo[0] = nil
+		h.undo = h.undo[1:]
+	}
+	for h.size > h.budget && len(h.redo) > 0 {
+		h.size -= h.redo[0].bytes
+		h.redo[0] = nil
+		h.redo = h.redo[1:]
+	}
+}
+
+// apply swaps the cells or the sandbox of the edit with the ones of s. A
+// stroke can replace the same cell more than once, so undoing goes through
+// the cells backwards.
+func (e *edit) apply(s *Sandbox, undo bool) *Sandbox {
+	if e.sandbox != nil {
+		s, e.sandbox = e.sandbox, s
+		e.bytes = e.sandbox.memSize()
+		return s
+	}
+	for i := range e.cells {
+		c := &e.cells[i]
+		if undo {
+			c = &e.cells[len(e.cells)-1-i]
+		}
+		old := s.GetCell(c.x, c.y)
+		s.SetCell(c.x, c.y, c.cell)
+		c.cell = old
+	}
+	return s
+}
+
+// cellEditSize is the memory a replaced cell uses at most.
+const cellEditSize = int(unsafe.Sizeof(editCell{}) + unsafe.Sizeof(Cell{}))
+
+// memSize returns the memory the cells of s use at most, counting the
+// unloaded chunks as they are once loaded back.
+func (s *Sandbox) memSize() int {
+	chunks := len(s.Chunks) + len(s.unloaded)
+	return chunks * s.cWidth * s.cHeight * int(unsafe.Sizeof(&Cell{})+unsafe.Sizeof(Cell{}))
+}
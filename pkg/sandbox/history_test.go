@@ -0,0 +1,138 @@
+package sandbox
+
+import (
+	"image"
+	"testing"
+)
+
+// cellsOf returns the cells of s by position.
+func cellsOf(s *Sandbox) map[image.Point]*Cell {
+	cells := map[image.Point]*Cell{}
+	b := s.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			cells[image.Pt(x, y)] = s.GetCell(x, y)
+		}
+	}
+	return cells
+}
+
+// sameCellsAs fails the test unless s holds exactly the cells of want.
+func sameCellsAs(t *testing.T, s *Sandbox, want map[image.Point]*Cell) {
+	t.Helper()
+	for p, cell := range cellsOf(s) {
+		if cell != want[p] {
+			t.Fatalf("cell at %v is %+v, want %+v", p, cell, want[p])
+		}
+	}
+}
+
+func TestHistoryUndoStroke(t *testing.T) {
+	s := newTestSandbox(t, 32, 32)
+	s.Paint(0, 10, 31, 10, 6, SAND)
+	before := cellsOf(s)
+
+	// Erasing replaces every cell, so the overlapping segments of the drag
+	// replace the air the previous ones left.
+	h := NewHistory(DefaultHistoryBudget)
+	h.Paint(s, 4, 10, 12, 10, 4, AIR, true)
+	h.Paint(s, 12, 10, 12, 14, 4, AIR, false)
+	h.Paint(s, 12, 14, 6, 10, 4, AIR, false)
+	after := cellsOf(s)
+	if len(h.undo) != 1 {
+		t.Fatalf("the drag made %d edits", len(h.undo))
+	}
+
+	s = h.Undo(s)
+	sameCellsAs(t, s, before)
+	s = h.Redo(s)
+	sameCellsAs(t, s, after)
+}
+
+func TestHistoryReplace(t *testing.T) {
+	a, b := newTestSandbox(t, 16, 16), newTestSandbox(t, 16, 16)
+	h := NewHistory(DefaultHistoryBudget)
+	h.Replace(a)
+	if got := h.Undo(b); got != a {
+		t.Fatal("undoing didn't bring the replaced sandbox back")
+	}
+	if got := h.Redo(a); got != b {
+		t.Fatal("redoing didn't bring the new sandbox back")
+	}
+	if got := h.Undo(b); got != a {
+		t.Fatal("undoing again didn't bring the replaced sandbox back")
+	}
+}
+
+func TestHistoryPushClearsRedo(t *testing.T) {
+	s := newTestSandbox(t, 16, 16)
+	h := NewHistory(DefaultHistoryBudget)
+	h.Paint(s, 4, 4, 4, 4, 2, SAND, true)
+	s = h.Undo(s)
+	h.Paint(s, 8, 8, 8, 8, 2, WATER, true)
+	painted := cellsOf(s)
+
+	s = h.Redo(s)
+	if len(h.redo) != 0 {
+		t.Error("a new edit left edits to redo")
+	}
+	sameCellsAs(t, s, painted)
+}
+
+func TestHistoryBudget(t *testing.T) {
+	// Every stroke paints 2x2 cells.
+	s := newTestSandbox(t, 64, 64)
+	h := NewHistory(10 * 4 * cellEditSize)
+	for i := 0; i < 20; i++ {
+		h.Paint(s, 2*i+1, 1, 2*i+1, 1, 2, SAND, true)
+	}
+	if h.size > h.budget || len(h.undo) != 10 {
+		t.Fatalf("%d edits use %d bytes of a budget of %d", len(h.undo), h.size, h.budget)
+	}
+	for len(h.undo) > 0 {
+		s = h.Undo(s)
+	}
+	if n := count(s, SAND); n != 40 {
+		t.Errorf("undoing every edit left %d of 80 cells, want the 40 of the oldest strokes", n)
+	}
+}
+
+func TestHistoryBudgetRedo(t *testing.T) {
+	// Undoing swaps the small sandbox for a larger one, which the budget
+	// can't keep to redo.
+	small, large := newTestSandbox(t, 64, 64), newTestSandbox(t, 256, 256)
+	small.SetCell(0, 0, small.NewCell(SAND))
+	for y := 0; y < 256; y += DefaultChunkSize {
+		for x := 0; x < 256; x += DefaultChunkSize {
+			large.SetCell(x, y, large.NewCell(SAND))
+		}
+	}
+	h := NewHistory(2 * small.memSize())
+	h.Replace(small)
+
+	s := h.Undo(large)
+	if s != small {
+		t.Fatal("undoing didn't bring the replaced sandbox back")
+	}
+	if h.size > h.budget {
+		t.Errorf("history uses %d bytes of a budget of %d", h.size, h.budget)
+	}
+	if h.Redo(s) != s {
+		t.Error("redid an edit over the budget")
+	}
+}
+
+func TestMemSizeUnloaded(t *testing.T) {
+	s := NewSandbox(SandboxConfig{ChunkWidth: 16, ChunkHeight: 16, Seed: 1})
+	walls(s, 0, 0, 3, 3)
+	walls(s, 500, 300, 503, 303)
+	size := s.memSize()
+	s.SetView(image.Rect(0, 0, 32, 32))
+	s.Update(false)
+	if len(s.unloaded) == 0 {
+		t.Fatal("no chunk was unloaded")
+	}
+	if s.memSize() != size {
+		t.Errorf("unloading chunks changed the size from %d to %d bytes", size, s.memSize())
+	}
+}
@@ -0,0 +1,60 @@
+package sandbox
+
+import (
+	"errors"
+	"image"
+	"image/color"
+)
+
+// Import fills the sandbox from 0, 0 with the cells of img, mapping every
+// pixel to the material with the nearest color. Transparent pixels are left
+// empty, and the parts of img outside of the sandbox are ignored.
+func (s *Sandbox) Import(img image.Image) {
+	types := Materials.Types()
+	b := img.Bounds()
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			if !s.inWorld(x, y) {
+				continue
+			}
+			c := color.RGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.RGBA)
+			cType := AIR
+			if c.A >= 0x80 {
+				cType = nearestMaterial(types, c)
+			}
+			if cType == AIR {
+				s.SetCell(x, y, nil)
+			} else {
+				s.SetCell(x, y, s.NewCell(cType))
+			}
+		}
+	}
+}
+
+// nearestMaterial returns the material whose color is the closest to c.
+func nearestMaterial(types []CellType, c color.RGBA) CellType {
+	nearest, best := AIR, -1
+	for _, cType := range types {
+		m := cType.Color()
+		dr := int(m.R) - int(c.R)
+		dg := int(m.G) - int(c.G)
+		db := int(m.B) - int(c.B)
+		if d := dr*dr + dg*dg + db*db; best < 0 || d < best {
+			nearest, best = cType, d
+		}
+	}
+	return nearest
+}
+
+// Image renders the sandbox the way Draw does, unloaded chunks included.
+// Unbounded sandboxes have no edges to render within, and cells far away would
+// make the image as large, so they are rejected.
+func (s *Sandbox) Image(temp bool) (*image.RGBA, error) {
+	if !s.Bounded() {
+		return nil, errors.New("an unbounded sandbox has no edges to render")
+	}
+	b := s.Bounds()
+	img := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	s.Draw(img.Pix, b, temp)
+	return img, nil
+}
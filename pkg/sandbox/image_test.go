@@ -0,0 +1,50 @@
+package sandbox
+
+import (
+	"image"
+	"testing"
+)
+
+// pixelAt returns the RGBA pixel of pix, drawn over view, at x, y.
+func pixelAt(pix []byte, view image.Rectangle, x, y int) []byte {
+	i := ((y-view.Min.Y)*view.Dx() + x - view.Min.X) * 4
+	return pix[i : i+4]
+}
+
+func TestDrawUnloadedChunks(t *testing.T) {
+	s := NewSandbox(SandboxConfig{ChunkWidth: 16, ChunkHeight: 16, Seed: 1})
+	walls(s, 0, 0, 3, 3)
+	walls(s, 500, 300, 503, 303)
+	s.SetView(image.Rect(0, 0, 32, 32))
+	s.Update(false)
+	if !s.unloaded[[2]int{31, 18}] {
+		t.Fatal("the far wall wasn't unloaded")
+	}
+
+	view := image.Rect(490, 290, 520, 320)
+	pix := make([]byte, view.Dx()*view.Dy()*4)
+	s.Draw(pix, view, false)
+	if p := pixelAt(pix, view, 504, 304); p[3] == 0 {
+		t.Error("the unloaded wall isn't drawn")
+	}
+	if p := pixelAt(pix, view, 501, 301); p[3] != 0 {
+		t.Error("the inside of the unloaded wall isn't empty")
+	}
+
+	// Chunks loaded back and unloaded again are drawn with their new cells.
+	s.SetCell(501, 301, s.NewCell(STONE))
+	s.SetView(image.Rect(0, 0, 32, 32))
+	s.Update(false)
+	s.Draw(pix, view, false)
+	if p := pixelAt(pix, view, 501, 301); p[3] == 0 {
+		t.Error("the stone painted into the unloaded chunk isn't drawn")
+	}
+}
+
+func TestImageUnbounded(t *testing.T) {
+	s := NewSandbox(SandboxConfig{ChunkWidth: 16, ChunkHeight: 16, Seed: 1})
+	walls(s, 0, 0, 3, 3)
+	if _, err := s.Image(false); err == nil {
+		t.Fatal("rendered an unbounded sandbox")
+	}
+}
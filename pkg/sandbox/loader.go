@@ -0,0 +1,409 @@
+package sandbox
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+//go:embed materials.json
+var defaultMaterials []byte
+
+// materialDef is the file representation of a Material.
+type materialDef struct {
+	Name             string        `json:"name"`
+	Color            string        `json:"color"`
+	Density          float64       `json:"density"`
+	Conductivity     int           `json:"conductivity"`
+	HeatCapacity     float64       `json:"heatCapacity"`
+	Flamable         bool          `json:"flamable"`
+	Movement         string        `json:"movement"`
+	Dispersion       int           `json:"dispersion"`
+	Temperature      float64       `json:"temperature"`
+	FixedTemperature bool          `json:"fixedTemperature"`
+	Solid            string        `json:"solid"`
+	Liquid           string        `json:"liquid"`
+	Gas              string        `json:"gas"`
+	MeltingPoint     *float64      `json:"meltingPoint"`
+	BoilingPoint     *float64      `json:"boilingPoint"`
+	LatentHeat       float64       `json:"latentHeat"`
+	BlastRadius      int           `json:"blastRadius"`
+	BlastPower       float64       `json:"blastPower"`
+	Conductive       bool          `json:"conductive"`
+	PowerSource      bool          `json:"powerSource"`
+	Resistance       float64       `json:"resistance"`
+	Reactions        []reactionDef `json:"reactions"`
+	Behavior         string        `json:"behavior"`
+}
+
+// reactionDef is the file representation of a Reaction. Empty Result and
+// Product leave the cells unchanged, and With "flamable" reacts with every
+// flamable material.
+type reactionDef struct {
+	With           string   `json:"with"`
+	Below          bool     `json:"below"`
+	Chance         float64  `json:"chance"`
+	MinTemperature *float64 `json:"minTemperature"`
+	MaxTemperature *float64 `json:"maxTemperature"`
+	Result         string   `json:"result"`
+	Product        string   `json:"product"`
+}
+
+var movements = map[string]Movement{
+	"static": Static,
+	"solid":  Solid,
+	"powder": Powder,
+	"liquid": Liquid,
+	"gas":    Gas,
+}
+
+// LoadMaterialsFile loads material definitions from a JSON file into
+// Materials.
+func LoadMaterialsFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := Materials.Load(f); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// Load reads a JSON array of material definitions. Materials with the name of
+// an already registered material replace its definition, others are added
+// to the registry. Nothing is registered if any definition is invalid.
+func (r *MaterialRegistry) Load(rd io.Reader) error {
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil {
+		return jsonError(data, err)
+	} else if tok != json.Delim('[') {
+		return errors.New("expected an array of materials")
+	}
+
+	var defs []materialDef
+	var positions []string
+	for i := 0; dec.More(); i++ {
+		var msg json.RawMessage
+		if err := dec.Decode(&msg); err != nil {
+			return jsonError(data, err)
+		}
+		pos := position(data, dec.InputOffset()-int64(len(msg)))
+
+		var def materialDef
+		entry := json.NewDecoder(bytes.NewReader(msg))
+		entry.DisallowUnknownFields()
+		if err := entry.Decode(&def); err != nil {
+			return fmt.Errorf("material %d at %s: %w", i, pos, err)
+		}
+		defs = append(defs, def)
+		positions = append(positions, pos)
+	}
+	if _, err := dec.Token(); err != nil {
+		return jsonError(data, err)
+	}
+
+	// Materials can react with ones defined later in the file, so every name
+	// gets its CellType before building them.
+	names := map[string]CellType{}
+	for name, cType := range r.names {
+		names[name] = cType
+	}
+	seen := map[string]int{}
+	next := CellType(len(r.materials))
+	for i, def := range defs {
+		if def.Name == "" {
+			return fmt.Errorf("material %d at %s: missing name", i, positions[i])
+		}
+		if j, ok := seen[def.Name]; ok {
+			return fmt.Errorf("material %d at %s: duplicate name %q, already defined by material %d", i, positions[i], def.Name, j)
+		}
+		seen[def.Name] = i
+		if _, ok := names[def.Name]; !ok {
+			names[def.Name] = next
+			next++
+		}
+	}
+
+	materials := make([]Material, len(defs))
+	for i, def := range defs {
+		m, err := def.material(names)
+		if err != nil {
+			return fmt.Errorf("material %d (%s) at %s: %w", i, def.Name, positions[i], err)
+		}
+		materials[i] = m
+	}
+
+	for _, m := range materials {
+		if cType, ok := r.Lookup(m.Name); ok {
+			r.set(cType, m)
+		} else {
+			r.Register(m)
+		}
+	}
+	return nil
+}
+
+func (def *materialDef) material(names map[string]CellType) (Material, error) {
+	c, err := parseColor(def.Color)
+	if err != nil {
+		return Material{}, err
+	}
+
+	movement, ok := movements[def.Movement]
+	if !ok {
+		return Material{}, fmt.Errorf("unknown movement %q", def.Movement)
+	}
+
+	var behavior Behavior
+	if def.Behavior != "" {
+		if behavior, ok = behaviors[def.Behavior]; !ok {
+			return Material{}, fmt.Errorf("unknown behavior %q", def.Behavior)
+		}
+	}
+
+	if def.Density < 0 {
+		return Material{}, errors.New("density must not be negative")
+	}
+	if def.Dispersion < 0 {
+		return Material{}, errors.New("dispersion must not be negative")
+	}
+	if def.Dispersion > MinChunkSize {
+		return Material{}, fmt.Errorf("dispersion must be at most %d", MinChunkSize)
+	}
+	if def.Conductivity < 0 {
+		return Material{}, errors.New("conductivity must not be negative")
+	}
+	if def.MeltingPoint != nil && def.BoilingPoint != nil && *def.MeltingPoint >= *def.BoilingPoint {
+		return Material{}, errors.New("melting point must be below boiling point")
+	}
+	if def.Conductivity > MaxConductivity {
+		return Material{}, fmt.Errorf("conductivity must not be above %d", MaxConductivity)
+	}
+	if def.HeatCapacity != 0 && def.HeatCapacity < 1 {
+		return Material{}, errors.New("heat capacity must be at least 1")
+	}
+	if def.LatentHeat < 0 {
+		return Material{}, errors.New("latent heat must not be negative")
+	}
+	if def.BlastRadius < 0 || def.BlastPower < 0 {
+		return Material{}, errors.New("blast radius and power must not be negative")
+	}
+	if def.Resistance < 0 || def.Resistance > 1 {
+		return Material{}, fmt.Errorf("resistance %v must be in [0, 1]", def.Resistance)
+	}
+	forms, err := def.forms(movement, names)
+	if err != nil {
+		return Material{}, err
+	}
+
+	self := names[def.Name]
+	reactions := make([]Reaction, len(def.Reactions))
+	for i, rd := range def.Reactions {
+		r, err := rd.reaction(self, names)
+		if err != nil {
+			return Material{}, fmt.Errorf("reaction %d: %w", i, err)
+		}
+		reactions[i] = r
+	}
+
+	return Material{
+		Name:             def.Name,
+		Color:            c,
+		Density:          def.Density,
+		Conductivity:     def.Conductivity,
+		HeatCapacity:     heatCapacity(def.HeatCapacity),
+		Flamable:         def.Flamable,
+		Movement:         movement,
+		Dispersion:       def.Dispersion,
+		Temperature:      def.Temperature,
+		FixedTemperature: def.FixedTemperature,
+		Reactions:        reactions,
+		SolidForm:        forms[0],
+		LiquidForm:       forms[1],
+		GasForm:          forms[2],
+		MeltingPoint:     value(def.MeltingPoint),
+		BoilingPoint:     value(def.BoilingPoint),
+		LatentHeat:       def.LatentHeat,
+		BlastRadius:      def.BlastRadius,
+		BlastPower:       def.BlastPower,
+		Conductive:       def.Conductive,
+		PowerSource:      def.PowerSource,
+		Resistance:       def.Resistance,
+		Behavior:         behavior,
+	}, nil
+}
+
+// forms resolves the solid, liquid and gas forms, checking that the material
+// can turn into them from the phase given by its movement.
+func (def *materialDef) forms(movement Movement, names map[string]CellType) ([3]CellType, error) {
+	type transition struct {
+		allowed bool
+		point   *float64
+		name    string
+	}
+	melting := transition{true, def.MeltingPoint, "melting point"}
+	boiling := transition{true, def.BoilingPoint, "boiling point"}
+
+	// transitions holds how the phase reaches the solid, liquid and gas forms.
+	var transitions [3]transition
+	phase := "solid"
+	switch movement {
+	case Liquid:
+		phase = "liquid"
+		transitions[0], transitions[2] = melting, boiling
+	case Gas:
+		phase = "gas"
+		transitions[1] = boiling
+	default:
+		transitions[1] = melting
+	}
+
+	forms := [3]CellType{None, None, None}
+	for i, form := range [3]struct{ field, name string }{
+		{"solid", def.Solid},
+		{"liquid", def.Liquid},
+		{"gas", def.Gas},
+	} {
+		if form.name == "" {
+			continue
+		}
+		cType, ok := names[form.name]
+		if !ok {
+			return forms, fmt.Errorf("%s: unknown material %q", form.field, form.name)
+		}
+		t := transitions[i]
+		if !t.allowed {
+			return forms, fmt.Errorf("%s: a %s material can't turn into a %s form", form.field, phase, form.field)
+		}
+		if t.point == nil {
+			return forms, fmt.Errorf("%s: missing %s", form.field, t.name)
+		}
+		forms[i] = cType
+	}
+	return forms, nil
+}
+
+func value(i *float64) float64 {
+	if i == nil {
+		return 0
+	}
+	return *i
+}
+
+// heatCapacity defaults the heat capacity to 1.
+func heatCapacity(c float64) float64 {
+	if c == 0 {
+		return 1
+	}
+	return c
+}
+
+func (def *reactionDef) reaction(self CellType, names map[string]CellType) (Reaction, error) {
+	r := Reaction{
+		With:    None,
+		Below:   def.Below,
+		Chance:  def.Chance,
+		MinTemp: math.Inf(-1),
+		MaxTemp: math.Inf(1),
+		Result:  self,
+	}
+
+	if def.Chance <= 0 || def.Chance > 1 {
+		return r, fmt.Errorf("chance %v must be in (0, 1]", def.Chance)
+	}
+	if def.MinTemperature != nil {
+		r.MinTemp = *def.MinTemperature
+	}
+	if def.MaxTemperature != nil {
+		r.MaxTemp = *def.MaxTemperature
+	}
+	if r.MinTemp > r.MaxTemp {
+		return r, errors.New("minimum temperature is above maximum temperature")
+	}
+
+	lookup := func(field, name string, cType *CellType) error {
+		if name == "" {
+			return nil
+		}
+		t, ok := names[name]
+		if !ok {
+			return fmt.Errorf("%s: unknown material %q", field, name)
+		}
+		*cType = t
+		return nil
+	}
+	if def.With == "flamable" {
+		r.With = AnyFlamable
+	} else if err := lookup("with", def.With, &r.With); err != nil {
+		return r, err
+	}
+	if err := lookup("result", def.Result, &r.Result); err != nil {
+		return r, err
+	}
+	r.Product = r.With
+	if err := lookup("product", def.Product, &r.Product); err != nil {
+		return r, err
+	}
+	if r.With == None && def.Product != "" {
+		return r, errors.New("product needs a material to react with")
+	}
+	if r.With == None && def.Below {
+		return r, errors.New("below needs a material to react with")
+	}
+	return r, nil
+}
+
+// parseColor parses colors in the #rrggbb or #rrggbbaa form.
+func parseColor(s string) (color.RGBA, error) {
+	c := color.RGBA{A: 0xff}
+	var err error
+	switch len(s) {
+	case 7:
+		_, err = fmt.Sscanf(s, "#%02x%02x%02x", &c.R, &c.G, &c.B)
+	case 9:
+		_, err = fmt.Sscanf(s, "#%02x%02x%02x%02x", &c.R, &c.G, &c.B, &c.A)
+	default:
+		err = errors.New("wrong length")
+	}
+	if err != nil {
+		return c, fmt.Errorf("invalid color %q: expected #rrggbb or #rrggbbaa", s)
+	}
+	return c, nil
+}
+
+// jsonError adds the position to JSON syntax and type errors.
+func jsonError(data []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return fmt.Errorf("%s: %w", position(data, syntaxErr.Offset), err)
+	case errors.As(err, &typeErr):
+		return fmt.Errorf("%s: %w", position(data, typeErr.Offset), err)
+	default:
+		return err
+	}
+}
+
+// position converts a byte offset into a line and column.
+func position(data []byte, offset int64) string {
+	before := string(data[:offset])
+	line := strings.Count(before, "\n") + 1
+	col := int(offset) - strings.LastIndex(before, "\n")
+	return fmt.Sprintf("line %d, column %d", line, col)
+}
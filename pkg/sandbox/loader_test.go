@@ -0,0 +1,70 @@
+package sandbox
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadErrors(t *testing.T) {
+	// Every file redefines SAND and adds FOAM before the broken material,
+	// neither of which may be registered.
+	const valid = `
+		{"name": "SAND", "color": "#ffffff", "movement": "powder"},
+		{"name": "FOAM", "color": "#ffffff", "movement": "static"},`
+	tests := []struct {
+		name, material, err string
+	}{
+		{
+			"unknown field",
+			`{"name": "GOO", "color": "#00ff00", "movement": "liquid", "viscosity": 3}`,
+			`material 2 at line 4, column 4: json: unknown field "viscosity"`,
+		},
+		{
+			"duplicate name",
+			`{"name": "FOAM", "color": "#00ff00", "movement": "liquid"}`,
+			`material 2 at line 4, column 4: duplicate name "FOAM", already defined by material 1`,
+		},
+		{
+			"unknown form",
+			`{"name": "GOO", "color": "#00ff00", "movement": "liquid", "solid": "JELLY", "meltingPoint": 0}`,
+			`material 2 (GOO) at line 4, column 4: solid: unknown material "JELLY"`,
+		},
+		{
+			"unknown reaction",
+			`{"name": "GOO", "color": "#00ff00", "movement": "liquid", "reactions": [{"with": "JELLY", "chance": 1}]}`,
+			`material 2 (GOO) at line 4, column 4: reaction 0: with: unknown material "JELLY"`,
+		},
+		{
+			"resistance",
+			`{"name": "GOO", "color": "#00ff00", "movement": "liquid", "resistance": 2}`,
+			`material 2 (GOO) at line 4, column 4: resistance 2 must be in [0, 1]`,
+		},
+		{
+			"chance",
+			`{"name": "GOO", "color": "#00ff00", "movement": "liquid", "reactions": [{"with": "SAND", "chance": 0}]}`,
+			`material 2 (GOO) at line 4, column 4: reaction 0: chance 0 must be in (0, 1]`,
+		},
+		{
+			"conductivity",
+			`{"name": "GOO", "color": "#00ff00", "movement": "liquid", "conductivity": 9}`,
+			`material 2 (GOO) at line 4, column 4: conductivity must not be above 8`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			types := Materials.Types()
+			sand := Materials.Get(SAND)
+
+			err := Materials.Load(strings.NewReader("[" + valid + "\n\t\t\t" + tt.material + "\n]"))
+			if err == nil || err.Error() != tt.err {
+				t.Fatalf("got error %v, want %s", err, tt.err)
+			}
+			if len(Materials.Types()) != len(types) || Materials.Get(SAND) != sand {
+				t.Error("the registry changed")
+			}
+			if _, ok := Materials.Lookup("FOAM"); ok {
+				t.Error("a material before the broken one was registered")
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package sandbox
+
+import (
+	"image/color"
+
+	"pgregory.net/rand"
+)
+
+// Movement is the way a material moves during the move pass.
+type Movement int
+
+const (
+	Static Movement = iota
+	Solid
+	Powder
+	Liquid
+	Gas
+)
+
+func (m Movement) move() func(w *Worker, x, y int, c *Cell) {
+	switch m {
+	case Solid:
+		return (*Worker).MoveSolid
+	case Powder:
+		return (*Worker).MovePowder
+	case Liquid:
+		return (*Worker).MoveLiquid
+	case Gas:
+		return func(w *Worker, x, y int, c *Cell) {
+			w.MoveGas(x, y, c)
+		}
+	default:
+		return nil
+	}
+}
+
+// Reaction turns a cell touching a neighbour of type With into Result, and
+// the neighbour into Product, with the given Chance per tick. Reactions
+// with None as With don't need a neighbour, and with AnyFlamable react with
+// any flamable material. Reactions Below only react with the cell under
+// this one.
+type Reaction struct {
+	With    CellType
+	Below   bool
+	Chance  float64
+	MinTemp float64
+	MaxTemp float64
+	Result  CellType
+	Product CellType
+}
+
+// matches reports whether the reaction happens with the neighbour other.
+func (r *Reaction) matches(other *Cell) bool {
+	if r.With == AnyFlamable {
+		return !isEmpty(other) && other.IsFlamable()
+	}
+	return cellType(other) == r.With
+}
+
+// Behavior is the part of a material that can't be described as data.
+type Behavior struct {
+	// Init sets up the state of newly created cells, drawing random numbers
+	// from r.
+	Init func(c *Cell, r *rand.Rand)
+	// BaseColor overrides Color depending on the state of the cell.
+	BaseColor func(c *Cell) color.RGBA
+	// Move overrides the default movement of the Movement kind.
+	Move func(w *Worker, x, y int, c *Cell)
+	// Update is called for every cell of this material in the state pass.
+	Update func(w *Worker, x, y int)
+	// Conducts overrides Conductive depending on the state of the cell.
+	Conducts func(c *Cell) bool
+}
+
+// Material holds everything the simulation needs to know about a CellType.
+type Material struct {
+	Name         string
+	Color        color.RGBA
+	Density      float64
+	Conductivity int
+	// HeatCapacity is the heat needed to warm a cell up by one degree, at
+	// least 1 for the heat to spread steadily.
+	HeatCapacity float64
+	// Flamable materials catch fire from the reactions with any flamable
+	// neighbour, like the ones of FIRE and LAVA. Materials burning their own
+	// way, like OIL and the explosives, aren't flamable.
+	Flamable bool
+	Movement Movement
+	// Dispersion is how many cells a liquid can flow sideways per tick, at
+	// most MinChunkSize.
+	Dispersion int
+	// Temperature of newly created cells. Cells of materials with a
+	// FixedTemperature keep it.
+	Temperature      float64
+	FixedTemperature bool
+	Reactions        []Reaction
+
+	// SolidForm, LiquidForm and GasForm are the materials this one turns into
+	// when crossing its MeltingPoint or BoilingPoint, None if it has none.
+	// Which transitions apply depends on the phase given by the Movement.
+	SolidForm    CellType
+	LiquidForm   CellType
+	GasForm      CellType
+	MeltingPoint float64
+	BoilingPoint float64
+	// LatentHeat is the extra heat needed to melt or boil, released again
+	// when freezing or condensing.
+	LatentHeat float64
+	// BlastRadius is the radius cleared when the material explodes, zero for
+	// materials that don't. BlastPower scales the heat and push of the blast.
+	BlastRadius int
+	BlastPower  float64
+	// Conductive materials carry sparks. PowerSource materials spark their
+	// neighbours all the time.
+	Conductive  bool
+	PowerSource bool
+	// Resistance is how well the material stands acid, from 0 to 1 for
+	// immune materials.
+	Resistance float64
+
+	Behavior
+}
+
+type MaterialRegistry struct {
+	materials []*Material
+	names     map[string]CellType
+}
+
+func NewMaterialRegistry() *MaterialRegistry {
+	return &MaterialRegistry{
+		names: map[string]CellType{},
+	}
+}
+
+// Materials is the registry used by the simulation.
+var Materials = NewMaterialRegistry()
+
+// Register adds a material to the registry and returns its CellType.
+func (r *MaterialRegistry) Register(m Material) CellType {
+	if _, ok := r.names[m.Name]; ok {
+		panic("sandbox: material " + m.Name + " registered twice")
+	}
+	cType := CellType(len(r.materials))
+	r.materials = append(r.materials, nil)
+	r.set(cType, m)
+	return cType
+}
+
+func (r *MaterialRegistry) set(cType CellType, m Material) {
+	if m.Move == nil {
+		m.Move = m.Movement.move()
+	}
+	r.materials[cType] = &m
+	r.names[m.Name] = cType
+}
+
+func (r *MaterialRegistry) Get(cType CellType) *Material {
+	return r.materials[cType]
+}
+
+func (r *MaterialRegistry) Lookup(name string) (CellType, bool) {
+	cType, ok := r.names[name]
+	return cType, ok
+}
+
+// Types returns every registered CellType in registration order.
+func (r *MaterialRegistry) Types() []CellType {
+	types := make([]CellType, len(r.materials))
+	for i := range types {
+		types[i] = CellType(i)
+	}
+	return types
+}
@@ -0,0 +1,38 @@
+package sandbox
+
+// Transition changes the cell at x, y into another form when its temperature
+// crosses the melting or boiling point of its material. It returns true when
+// the cell has been replaced.
+func (w *Worker) Transition(x, y int, cell *Cell) bool {
+	m := cell.Material()
+	temp := cell.temp
+
+	switch m.Movement {
+	case Liquid:
+		if m.SolidForm != None && temp < m.MeltingPoint {
+			w.changePhase(x, y, m.SolidForm, temp+m.LatentHeat)
+			return true
+		}
+		if m.GasForm != None && temp >= m.BoilingPoint+m.LatentHeat {
+			w.changePhase(x, y, m.GasForm, temp-m.LatentHeat)
+			return true
+		}
+	case Gas:
+		if m.LiquidForm != None && temp < m.BoilingPoint {
+			w.changePhase(x, y, m.LiquidForm, temp+m.LatentHeat)
+			return true
+		}
+	default:
+		if m.LiquidForm != None && temp >= m.MeltingPoint+m.LatentHeat {
+			w.changePhase(x, y, m.LiquidForm, temp-m.LatentHeat)
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Worker) changePhase(x, y int, cType CellType, temp float64) {
+	cell := w.NewCell(cType)
+	cell.temp = temp
+	w.SetCell(x, y, cell)
+}
@@ -0,0 +1,135 @@
+package sandbox
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mrmarble/sandbox/pkg/misc"
+)
+
+// workerPool updates chunks on a fixed set of goroutines, each with a Worker
+// of its own, so the passes of an update don't start goroutines or allocate
+// workers.
+type workerPool struct {
+	workers []*Worker
+	// batches wakes the goroutines of the pool, all but the first worker,
+	// which runs on the goroutine calling the pool.
+	batches []chan *batch
+
+	// batch is reused by every call, along with the outboxes holding what
+	// the workers left for other chunks, by chunk.
+	batch    batch
+	outboxes []outbox
+}
+
+// batch is an update run over chunks by all the goroutines of a pool.
+type batch struct {
+	sandbox *Sandbox
+	chunks  []*Chunk
+	update  func(w *Worker)
+	// next is the index of the next chunk to update.
+	next     int64
+	outboxes []outbox
+	wg       sync.WaitGroup
+}
+
+// pool is shared by every sandbox. The passes of an update hold poolMutex
+// while they use it, so sandboxes can be updated from several goroutines.
+var (
+	pool      = newWorkerPool(0)
+	poolMutex sync.Mutex
+)
+
+// SetParallelism sets how many chunks every sandbox updates at once. 1 updates
+// them one after the other on the goroutine calling Update, which is easier
+// to debug, and 0 or less uses one goroutine per CPU. The result of an update
+// is the same whatever the parallelism.
+func SetParallelism(n int) {
+	poolMutex.Lock()
+	defer poolMutex.Unlock()
+	pool.close()
+	pool = newWorkerPool(n)
+}
+
+// Parallelism returns how many chunks every sandbox updates at once.
+func Parallelism() int {
+	poolMutex.Lock()
+	defer poolMutex.Unlock()
+	return len(pool.workers)
+}
+
+// newWorkerPool creates a pool of n goroutines, or of GOMAXPROCS goroutines
+// if n is 0 or less.
+func newWorkerPool(n int) *workerPool {
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	p := &workerPool{
+		workers: make([]*Worker, n),
+		batches: make([]chan *batch, n-1),
+	}
+	for i := range p.workers {
+		p.workers[i] = &Worker{}
+	}
+	for i := range p.batches {
+		p.batches[i] = make(chan *batch)
+		go func(w *Worker, batches chan *batch) {
+			for b := range batches {
+				b.run(w)
+				b.wg.Done()
+			}
+		}(p.workers[i+1], p.batches[i])
+	}
+	return p
+}
+
+// close stops the goroutines of the pool. It must not be used afterwards.
+func (p *workerPool) close() {
+	for _, batches := range p.batches {
+		close(batches)
+	}
+}
+
+// each runs update on every chunk of s and returns what the workers left for
+// other chunks, in the order of chunks. The outboxes are valid until the next
+// call.
+func (p *workerPool) each(s *Sandbox, chunks []*Chunk, update func(w *Worker)) []outbox {
+	if len(chunks) == 0 {
+		return nil
+	}
+	for _, w := range p.workers {
+		w.reset()
+	}
+	if cap(p.outboxes) < len(chunks) {
+		p.outboxes = make([]outbox, len(chunks))
+	}
+	b := &p.batch
+	b.sandbox, b.chunks, b.update = s, chunks, update
+	b.next = 0
+	b.outboxes = p.outboxes[:len(chunks)]
+
+	// Chunks are handed out one at a time, so there's no use waking more
+	// goroutines than there are chunks.
+	helpers := misc.Min(len(p.batches), len(chunks)-1)
+	b.wg.Add(helpers)
+	for _, batches := range p.batches[:helpers] {
+		batches <- b
+	}
+	b.run(p.workers[0])
+	b.wg.Wait()
+	return b.outboxes
+}
+
+// run updates the chunks of the batch with w until none are left.
+func (b *batch) run(w *Worker) {
+	for {
+		i := int(atomic.AddInt64(&b.next, 1) - 1)
+		if i >= len(b.chunks) {
+			return
+		}
+		w.begin(b.sandbox, b.chunks[i])
+		b.update(w)
+		b.outboxes[i] = w.done()
+	}
+}
@@ -0,0 +1,81 @@
+package sandbox
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+// denseScene returns a sandbox filled with reacting, burning, melting and
+// conducting materials, so every chunk writes to the ones around it.
+func denseScene(t testing.TB, chunkWidth, chunkHeight int) *Sandbox {
+	t.Helper()
+	s := NewSandbox(SandboxConfig{Width: 120, Height: 90, ChunkWidth: chunkWidth, ChunkHeight: chunkHeight, Seed: 3})
+	types := []CellType{
+		SAND, WATER, OIL, SMOKE, STONE, FIRE, ICE, LAVA, ACID, PLANT,
+		MUD, CLNE, WOOD, GUNP, BTRY, COIL, IRON, HEATR, COOLR, STEAM,
+	}
+	for x := 0; x < 120; x++ {
+		for y := 0; y < 90; y++ {
+			if (x+y)%4 != 0 {
+				s.SetCell(x, y, s.NewCell(types[(x/3+y/2)%len(types)]))
+			}
+		}
+	}
+	return s
+}
+
+// TestUpdateRace updates a dense scene one chunk at a time and several at
+// once, which must end the same. Run it with -race to check the chunks
+// updated at once don't write to each other's cells.
+func TestUpdateRace(t *testing.T) {
+	defer SetParallelism(0)
+	for _, size := range [][2]int{{DefaultChunkSize, DefaultChunkSize}, {13, 9}, {MinChunkSize, MinChunkSize}} {
+		t.Run(fmt.Sprintf("%dx%d", size[0], size[1]), func(t *testing.T) {
+			var sandboxes []*Sandbox
+			for _, n := range []int{1, 4} {
+				SetParallelism(n)
+				s := denseScene(t, size[0], size[1])
+				for i := 0; i < 40; i++ {
+					s.Update(true)
+				}
+				sandboxes = append(sandboxes, s)
+			}
+			sameCells(t, sandboxes[0], sandboxes[1])
+		})
+	}
+}
+
+// benchScene returns a game sized sandbox with layers of falling, flowing,
+// burning and melting materials, like the one of the bench command.
+func benchScene(b *testing.B) *Sandbox {
+	b.Helper()
+	const width, height = 590, 430
+	s := newTestSandbox(b, width, height)
+	layers := []CellType{SAND, WATER, OIL, FIRE, STONE, LAVA, ICE, WOOD}
+	for i, m := range layers {
+		y := 30 + i*height/len(layers)
+		s.Paint(0, y, width-1, y, 30, m)
+	}
+	return s
+}
+
+func BenchmarkUpdate(b *testing.B) {
+	defer SetParallelism(0)
+	runs := []struct {
+		name    string
+		workers int
+	}{
+		{"1", 1}, {"2", 2}, {"4", 4}, {"GOMAXPROCS", runtime.GOMAXPROCS(0)},
+	}
+	for _, run := range runs {
+		b.Run(run.name, func(b *testing.B) {
+			SetParallelism(run.workers)
+			s := benchScene(b)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s.Update(true)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package sandbox
+
+import (
+	"math"
+
+	"github.com/mrmarble/sandbox/pkg/misc"
+)
+
+const (
+	// PressureBlock is the size in cells of the square blocks sharing a
+	// pressure value.
+	PressureBlock = 4
+	// GasPressure is the pressure added every tick by each gas cell.
+	GasPressure = 0.005
+	// PressureDiffusion is the fraction of the pressure difference between
+	// two open blocks that evens out every tick.
+	PressureDiffusion = 0.2
+	// PressureDecay is the fraction of pressure lost every tick.
+	PressureDecay = 0.05
+	// PressureForce scales the push of a pressure gradient on loose cells.
+	PressureForce = 0.5
+	// MinPressureGradient is the weakest gradient that moves cells.
+	MinPressureGradient = 0.2
+)
+
+type pressureField struct {
+	width, height int
+	pressure      []float64
+	next          []float64
+	// openness is the fraction of cells in each block letting gases through.
+	openness []float64
+	sources  []float64
+}
+
+func newPressureField(width, height int) pressureField {
+	w := (width + PressureBlock - 1) / PressureBlock
+	h := (height + PressureBlock - 1) / PressureBlock
+	return pressureField{
+		width:    w,
+		height:   h,
+		pressure: make([]float64, w*h),
+		next:     make([]float64, w*h),
+		openness: make([]float64, w*h),
+		sources:  make([]float64, w*h),
+	}
+}
+
+func (c *Chunk) blockIndex(x, y int) int {
+	bx := (x - c.left) / PressureBlock
+	by := (y - c.top) / PressureBlock
+	return bx + by*c.pressure.width
+}
+
+// Pressure returns the pressure at x, y.
+func (s *Sandbox) Pressure(x, y int) float64 {
+	if c := s.lookupChunk(x, y); c != nil {
+		return c.pressure.pressure[c.blockIndex(x, y)]
+	}
+	return 0
+}
+
+// AddPressure adds pressure to the block holding x, y. It must not be called
+// during the parallel passes.
+func (s *Sandbox) AddPressure(x, y int, amount float64) {
+	if !s.InBounds(x, y) {
+		return
+	}
+	c := s.GetChunk(x, y)
+	c.pressure.pressure[c.blockIndex(x, y)] += amount
+	c.KeepAlive(x, y)
+}
+
+// PressureUpdate moves pressure from high to low pressure blocks, through
+// the open ones only, so sealed containers keep it.
+func (s *Sandbox) PressureUpdate() {
+	poolMutex.Lock()
+	defer poolMutex.Unlock()
+	pool.each(s, s.Chunks, func(w *Worker) {
+		w.chunk.updatePressureSources()
+	})
+	pool.each(s, s.Chunks, (*Worker).UpdateChunkPressure)
+
+	for _, chunk := range s.Chunks {
+		p := &chunk.pressure
+		p.pressure, p.next = p.next, p.pressure
+	}
+}
+
+// updatePressureSources counts the open cells and the gases of every block.
+func (c *Chunk) updatePressureSources() {
+	p := &c.pressure
+	for i := range p.openness {
+		p.openness[i] = 0
+		p.sources[i] = 0
+	}
+
+	for i, cell := range c.cells {
+		x := i % c.Width / PressureBlock
+		y := i / c.Width / PressureBlock
+		b := x + y*p.width
+		if isEmpty(cell) {
+			p.openness[b]++
+			continue
+		}
+		switch cell.Material().Movement {
+		case Gas:
+			p.openness[b]++
+			p.sources[b] += GasPressure
+		case Liquid, Powder:
+			p.openness[b]++
+		}
+	}
+
+	for b := range p.openness {
+		bw := misc.Min(PressureBlock, c.Width-b%p.width*PressureBlock)
+		bh := misc.Min(PressureBlock, c.Height-b/p.width*PressureBlock)
+		p.openness[b] /= float64(bw * bh)
+	}
+}
+
+func (w *Worker) UpdateChunkPressure() {
+	p := &w.chunk.pressure
+	for by := 0; by < p.height; by++ {
+		for bx := 0; bx < p.width; bx++ {
+			b := bx + by*p.width
+			pressure := p.pressure[b]
+			flow := 0.0
+			for _, dir := range directions {
+				other, openness := w.neighbourBlock(bx+dir[0], by+dir[1])
+				flow += PressureDiffusion / 4 * math.Min(p.openness[b], openness) * (other - pressure)
+			}
+			p.next[b] = (pressure + flow + p.sources[b]) * (1 - PressureDecay)
+		}
+	}
+}
+
+// neighbourBlock returns the pressure and openness of a block given in block
+// coordinates relative to the worker chunk. Blocks in missing chunks are
+// open air, blocks outside the sandbox are closed.
+func (w *Worker) neighbourBlock(bx, by int) (float64, float64) {
+	p := &w.chunk.pressure
+	if bx >= 0 && by >= 0 && bx < p.width && by < p.height {
+		b := bx + by*p.width
+		return p.pressure[b], p.openness[b]
+	}
+
+	x := w.chunk.left + bx*PressureBlock
+	y := w.chunk.top + by*PressureBlock
+	if bx < 0 {
+		x = w.chunk.left - 1
+	}
+	if by < 0 {
+		y = w.chunk.top - 1
+	}
+	if !w.sandbox.inWorld(x, y) {
+		return 0, 0
+	}
+	c := w.chunkAt(x, y)
+	if c == nil {
+		return 0, 1
+	}
+	b := c.blockIndex(x, y)
+	return c.pressure.pressure[b], c.pressure.openness[b]
+}
+
+// pressure returns the pressure at x, y, around the chunk of the worker.
+func (w *Worker) pressure(x, y int) float64 {
+	if c := w.chunkAt(x, y); c != nil {
+		return c.pressure.pressure[c.blockIndex(x, y)]
+	}
+	return 0
+}
+
+// PressureGradient returns the pressure gradient around x, y. The sandbox
+// edges don't push cells.
+func (w *Worker) PressureGradient(x, y int) (float64, float64) {
+	pressure := w.pressure(x, y)
+	at := func(x, y int) float64 {
+		if !w.sandbox.inWorld(x, y) {
+			return pressure
+		}
+		return w.pressure(x, y)
+	}
+	gx := at(x+PressureBlock, y) - at(x-PressureBlock, y)
+	gy := at(x, y+PressureBlock) - at(x, y-PressureBlock)
+	return gx / 2, gy / 2
+}
+
+// pushCell accelerates a loose cell down the pressure gradient.
+func (w *Worker) pushCell(x, y int, cell *Cell) {
+	gx, gy := w.PressureGradient(x, y)
+	if math.Abs(gx) < MinPressureGradient && math.Abs(gy) < MinPressureGradient {
+		return
+	}
+	cell.velX = misc.Clamp(cell.velX-gx*PressureForce, -TerminalVelocity, TerminalVelocity)
+	cell.velY = misc.Clamp(cell.velY-gy*PressureForce, -TerminalVelocity, TerminalVelocity)
+}
+
+// expand returns where a gas moves to follow the pressure gradient, or false
+// when the gradient is too weak or the way is blocked.
+func (w *Worker) expand(x, y int, cell *Cell) (int, int, bool) {
+	gx, gy := w.PressureGradient(x, y)
+	if math.Abs(gx) < MinPressureGradient && math.Abs(gy) < MinPressureGradient {
+		return x, y, false
+	}
+
+	xn, yn := x, y
+	if math.Abs(gx) > math.Abs(gy) {
+		xn -= int(math.Copysign(1, gx))
+	} else {
+		yn -= int(math.Copysign(1, gy))
+	}
+	if !w.CanDisplace(xn, yn, cell) {
+		return x, y, false
+	}
+	return xn, yn, true
+}
@@ -0,0 +1,73 @@
+package sandbox
+
+// below is the direction of the neighbour of reactions with Below set.
+var below = [][]int{{0, 1}}
+
+// React applies the reactions of the cell at x, y. It returns true when the
+// cell has been replaced. Cells waiting for a reaction keep their chunk
+// updating, even if nothing moves around them.
+func (w *Worker) React(x, y int, cell *Cell) bool {
+	for _, r := range cell.Material().Reactions {
+		if cell.temp < r.MinTemp || cell.temp > r.MaxTemp {
+			continue
+		}
+
+		if r.With == None {
+			if w.rand.Float64() < r.Chance {
+				w.SetCell(x, y, w.reactionCell(cell, r.Result))
+				return true
+			}
+			w.keepAlive(x, y)
+			continue
+		}
+
+		dirs := directions
+		if r.Below {
+			dirs = below
+		}
+		for _, dir := range dirs {
+			nx, ny := x+dir[0], y+dir[1]
+			if !w.InBounds(nx, ny) {
+				continue
+			}
+			other := w.GetCell(nx, ny)
+			if !r.matches(other) {
+				continue
+			}
+			if w.rand.Float64() >= r.Chance {
+				w.keepAlive(x, y)
+				continue
+			}
+
+			product := r.Product
+			if product == AnyFlamable {
+				// Left unchanged, as the product defaults to the neighbour.
+				product = cellType(other)
+			}
+			w.SetCell(nx, ny, w.reactionCell(other, product))
+			if r.Result != cell.CType {
+				w.SetCell(x, y, w.reactionCell(cell, r.Result))
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// reactionCell returns the cell that replaces cell when it turns into cType.
+func (w *Worker) reactionCell(cell *Cell, cType CellType) *Cell {
+	if cType == cellType(cell) {
+		return cell
+	}
+	if cType == AIR {
+		return nil
+	}
+	return w.NewCell(cType)
+}
+
+func cellType(cell *Cell) CellType {
+	if isEmpty(cell) {
+		return AIR
+	}
+	return cell.CType
+}
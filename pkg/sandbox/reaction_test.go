@@ -0,0 +1,140 @@
+package sandbox
+
+import (
+	"strings"
+	"testing"
+)
+
+// burns tells whether fire burns into cType, ceiling of a walled room with a
+// fire in it.
+func burns(t *testing.T, cType CellType) bool {
+	s := newTestSandbox(t, 16, 16)
+	walls(s, 2, 2, 8, 8)
+	for x := 2; x <= 8; x++ {
+		for y := 2; y <= 4; y++ {
+			s.SetCell(x, y, s.NewCell(cType))
+		}
+	}
+	s.SetCell(5, 8, s.NewCell(FIRE))
+	for i := 0; i < 100; i++ {
+		s.Update(false)
+	}
+	return count(s, cType) < 21
+}
+
+func TestFireBurnsFlamable(t *testing.T) {
+	for _, cType := range []CellType{WOOD, PLANT} {
+		if !burns(t, cType) {
+			t.Errorf("fire didn't burn %s", cType)
+		}
+	}
+}
+
+func TestFireBurnsLoadedFlamable(t *testing.T) {
+	restoreMaterials(t)
+	err := Materials.Load(strings.NewReader(`[
+		{"name": "PAPER", "color": "#f0f0e0", "density": 0.5, "flamable": true, "movement": "static"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	paper, _ := Materials.Lookup("PAPER")
+	if !burns(t, paper) {
+		t.Error("fire didn't burn a loaded flamable material")
+	}
+}
+
+func TestFireSparesNonFlamable(t *testing.T) {
+	for _, cType := range []CellType{STONE, IRON} {
+		if burns(t, cType) {
+			t.Errorf("fire burnt %s", cType)
+		}
+	}
+}
+
+func TestLavaIgnitesFlamable(t *testing.T) {
+	s := newTestSandbox(t, 16, 16)
+	walls(s, 2, 2, 8, 8)
+	for x := 2; x <= 8; x++ {
+		s.SetCell(x, 8, s.NewCell(WOOD))
+	}
+	for x := 4; x <= 6; x++ {
+		s.SetCell(x, 2, s.NewCell(LAVA))
+	}
+	for i := 0; i < 100; i++ {
+		s.Update(false)
+	}
+	if n := count(s, WOOD); n == 7 {
+		t.Error("lava didn't ignite the wood under it")
+	}
+	if n := count(s, LAVA); n != 3 {
+		t.Errorf("%d cells of LAVA left, want 3", n)
+	}
+}
+
+func TestWaterSoaksSandBelow(t *testing.T) {
+	s := newTestSandbox(t, 16, 16)
+	// Water poured into a narrow well of sand.
+	walls(s, 3, 2, 3, 12)
+	for y := 6; y <= 12; y++ {
+		s.SetCell(3, y, s.NewCell(SAND))
+	}
+	for y := 2; y <= 4; y++ {
+		s.SetCell(3, y, s.NewCell(WATER))
+	}
+	for i := 0; i < 100; i++ {
+		s.Update(false)
+	}
+
+	if n := count(s, WATER); n != 0 {
+		t.Fatalf("%d cells of WATER left", n)
+	}
+	// Each cell of water soaked one cell of sand, from the top of the well.
+	for y := 12; y >= 6; y-- {
+		want := SAND
+		if y <= 8 {
+			want = MUD
+		}
+		if got := cellType(s.GetCell(3, y)); got != want {
+			t.Errorf("cell at 3, %d is %s, want %s", y, got, want)
+		}
+	}
+}
+
+func TestWaterLeavesSandBeside(t *testing.T) {
+	s := newTestSandbox(t, 16, 16)
+	walls(s, 2, 2, 3, 2)
+	s.SetCell(2, 2, s.NewCell(WATER))
+	s.SetCell(3, 2, s.NewCell(SAND))
+	s.KeepAlive(2, 2)
+	for i := 0; i < 100; i++ {
+		s.Update(false)
+	}
+	if got := cellType(s.GetCell(3, 2)); got != SAND {
+		t.Fatalf("sand beside water turned into %s", got)
+	}
+}
+
+func TestMudDries(t *testing.T) {
+	s := newTestSandbox(t, 16, 16)
+	walls(s, 2, 2, 2, 2)
+	mud := s.NewCell(MUD)
+	mud.temp = 40
+	s.SetCell(2, 2, mud)
+	s.Update(false)
+	if got := cellType(s.GetCell(2, 2)); got != SAND {
+		t.Fatalf("mud at 40°C turned into %s, want SAND", got)
+	}
+}
+
+func TestSandMelts(t *testing.T) {
+	s := newTestSandbox(t, 16, 16)
+	walls(s, 2, 2, 2, 2)
+	sand := s.NewCell(SAND)
+	sand.temp = 130
+	s.SetCell(2, 2, sand)
+	s.Update(false)
+	if got := cellType(s.GetCell(2, 2)); got != MGLS {
+		t.Fatalf("sand at 130°C turned into %s, want MGLS", got)
+	}
+}
@@ -1,64 +1,260 @@
 package sandbox
 
 import (
-	"strconv"
+	"fmt"
+	"image"
+	"log"
+	"math"
+	"sort"
 	"sync"
 
 	"github.com/mrmarble/sandbox/pkg/misc"
-	cmap "github.com/orcaman/concurrent-map/v2"
+	"pgregory.net/rand"
 )
 
 type Sandbox struct {
+	// width and height are 0 for unbounded sandboxes.
 	width, height   int
 	cWidth, cHeight int
 
-	Chunks      []*Chunk
-	chunkLookup cmap.ConcurrentMap[string, *Chunk]
+	Chunks []*Chunk
+	// chunkLookup finds the chunks by location. It's only changed between
+	// the phases of an update, so workers can read it at once.
+	chunkLookup map[[2]int]*Chunk
+	// phaseChunks and heatRun keep the memory of the phases and of the
+	// chunks whose heat is updated between updates.
+	phaseChunks [4][]*Chunk
+	heatRun     []*Chunk
 
-	chunkMutex sync.Mutex
+	// The chunks far from the view are unloaded to the store, and frozen
+	// until something reaches them or the view comes back.
+	view     image.Rectangle
+	store    ChunkStore
+	unloaded map[[2]int]bool
+	// unloadedPix caches the pixels of the unloaded chunks drawn, which don't
+	// change until they are loaded back.
+	unloadedPix map[[2]int]chunkPixels
+
+	ambient     float64
+	ambientRate float64
+
+	// seed and tick derive the random source of every chunk, and rand is
+	// used outside of the chunk updates.
+	seed uint64
+	tick uint64
+	rand *rand.Rand
+
+	explosions      []explosion
+	explosionsMutex sync.Mutex
 }
 
-func hash(x, y int) string {
-	return strconv.Itoa(x*0xf1f1f1f1 ^ y)
+const (
+	// DefaultChunkSize is the side of the chunks of the game.
+	DefaultChunkSize = 64
+	// MinChunkSize is the smallest side a chunk can have. It is as far as a
+	// cell reaches in a tick, falling at TerminalVelocity, flowing by its
+	// Dispersion, cloning, growing or feeling the pressure PressureBlock
+	// cells away, so updating a chunk only touches the chunks around it.
+	MinChunkSize = 8
+	// MaxChunkSize is the largest side a chunk can have.
+	MaxChunkSize = 1 << 12
+)
+
+// SandboxConfig sets the size of a sandbox and of its chunks.
+type SandboxConfig struct {
+	// Width and Height are the size of the sandbox in cells, or both 0 for
+	// an unbounded sandbox.
+	Width, Height int
+	// ChunkWidth and ChunkHeight are the size of the chunks, between
+	// MinChunkSize and MaxChunkSize. When the sandbox isn't a multiple of
+	// them, the chunks on its right and bottom edges are smaller.
+	ChunkWidth, ChunkHeight int
+	// Seed is what the randomness of the sandbox is drawn from.
+	Seed uint64
 }
 
-const MaxChunks = 10
+// Validate reports whether a sandbox can be created with the config.
+func (c SandboxConfig) Validate() error {
+	if c.ChunkWidth < MinChunkSize || c.ChunkHeight < MinChunkSize || c.ChunkWidth > MaxChunkSize || c.ChunkHeight > MaxChunkSize {
+		return fmt.Errorf("invalid chunk size %dx%d", c.ChunkWidth, c.ChunkHeight)
+	}
+	if (c.Width == 0) != (c.Height == 0) || c.Width < 0 || c.Height < 0 || c.Width > math.MaxInt32 || c.Height > math.MaxInt32 {
+		return fmt.Errorf("invalid sandbox size %dx%d", c.Width, c.Height)
+	}
+	return nil
+}
 
-func NewSandbox(width, height int) *Sandbox {
-	cWidth := width / MaxChunks
-	cHeight := height / MaxChunks
+// NewSandbox creates a sandbox from config, which must be valid. Two
+// sandboxes with the same seed and the same cells evolve the same way.
+func NewSandbox(config SandboxConfig) *Sandbox {
+	if err := config.Validate(); err != nil {
+		panic(err)
+	}
 	return &Sandbox{
-		width:       width,
-		height:      height,
-		cWidth:      cWidth,
-		cHeight:     cHeight,
+		width:       config.Width,
+		height:      config.Height,
+		cWidth:      config.ChunkWidth,
+		cHeight:     config.ChunkHeight,
 		Chunks:      []*Chunk{},
-		chunkLookup: cmap.New[*Chunk](),
+		chunkLookup: map[[2]int]*Chunk{},
+		store:       newMemStore(),
+		unloaded:    map[[2]int]bool{},
+		unloadedPix: map[[2]int]chunkPixels{},
+		ambientRate: DefaultAmbientRate,
+		seed:        config.Seed,
+		rand:        rand.New(config.Seed),
+	}
+}
+
+// Config returns the config the sandbox was created with.
+func (s *Sandbox) Config() SandboxConfig {
+	return SandboxConfig{
+		Width:       s.width,
+		Height:      s.height,
+		ChunkWidth:  s.cWidth,
+		ChunkHeight: s.cHeight,
+		Seed:        s.seed,
+	}
+}
+
+// Size returns the width and height of the sandbox in cells, which are 0 if
+// it's unbounded.
+func (s *Sandbox) Size() (int, int) {
+	return s.width, s.height
+}
+
+// Bounded reports whether the sandbox has edges.
+func (s *Sandbox) Bounded() bool {
+	return s.width > 0
+}
+
+// inWorld reports whether x, y is within the edges of the sandbox.
+func (s *Sandbox) inWorld(x, y int) bool {
+	return !s.Bounded() || x >= 0 && x < s.width && y >= 0 && y < s.height
+}
+
+// Bounds returns the area of the sandbox, or the area of its chunks, loaded
+// or not, if it's unbounded.
+func (s *Sandbox) Bounds() image.Rectangle {
+	if s.Bounded() {
+		return image.Rect(0, 0, s.width, s.height)
 	}
+	var r image.Rectangle
+	for _, c := range s.Chunks {
+		r = r.Union(c.Bounds())
+	}
+	for key := range s.unloaded {
+		r = r.Union(s.chunkBounds(key[0], key[1]))
+	}
+	return r
+}
+
+func (s *Sandbox) Seed() uint64 {
+	return s.seed
+}
+
+// Tick returns the number of updates run so far.
+func (s *Sandbox) Tick() uint64 {
+	return s.tick
+}
+
+// NewCell creates a cell drawing its random state from the sandbox. It must
+// not be called during an update.
+func (s *Sandbox) NewCell(cType CellType) *Cell {
+	return newCell(cType, s.rand)
+}
+
+// chunkRand returns the random source of the chunk at x, y for the current
+// tick.
+func (s *Sandbox) chunkRand(x, y int) *rand.Rand {
+	return rand.New(s.seed, s.tick, uint64(uint32(x))<<32|uint64(uint32(y)))
+}
+
+// sortChunks puts the chunks in a fixed order, as they are added in the
+// order cells reach them.
+func (s *Sandbox) sortChunks() {
+	sortChunks(s.Chunks)
+}
+
+func sortChunks(chunks []*Chunk) {
+	sort.Slice(chunks, func(i, j int) bool {
+		a, b := chunks[i], chunks[j]
+		if a.Y != b.Y {
+			return a.Y < b.Y
+		}
+		return a.X < b.X
+	})
 }
 
+// GetChunk returns the chunk holding x, y, creating it if needed. It returns
+// nil past the edges of the sandbox.
 func (s *Sandbox) GetChunk(x, y int) *Chunk {
+	if !s.inWorld(x, y) {
+		return nil
+	}
 	cx, cy := s.GetChunkLocation(x, y)
-	if chunk, ok := s.chunkLookup.Get(hash(cx, cy)); ok {
+	if chunk, ok := s.chunkLookup[[2]int{cx, cy}]; ok {
 		return chunk
 	}
 	return s.CreateChunk(cx, cy)
 }
 
+// lookupChunk returns the chunk holding x, y without creating it.
+func (s *Sandbox) lookupChunk(x, y int) *Chunk {
+	cx, cy := s.GetChunkLocation(x, y)
+	chunk, ok := s.chunkLookup[[2]int{cx, cy}]
+	if !ok || !chunk.InBounds(x, y) {
+		return nil
+	}
+	return chunk
+}
+
+// CreateChunk returns the chunk at x, y, creating it or loading it back from
+// the store if needed. It returns nil past the edges of the sandbox.
 func (s *Sandbox) CreateChunk(x, y int) *Chunk {
-	if x < 0 || y < 0 || x >= MaxChunks || y >= MaxChunks {
+	area := s.chunkBounds(x, y)
+	if area.Empty() {
 		return nil
 	}
-	chunk := NewChunk(s.cWidth, s.cHeight, x, y)
-	s.chunkMutex.Lock()
+
+	if chunk, ok := s.chunkLookup[[2]int{x, y}]; ok {
+		return chunk
+	}
+	chunk := NewChunk(x, y, area)
+	chunk.rand = s.chunkRand(x, y)
+	if s.unloaded[[2]int{x, y}] {
+		if err := s.reload(chunk); err != nil {
+			log.Printf("chunk %d,%d: %v", x, y, err)
+		}
+	}
 	s.Chunks = append(s.Chunks, chunk)
-	s.chunkMutex.Unlock()
-	s.chunkLookup.Set(hash(x, y), chunk)
+	s.chunkLookup[[2]int{x, y}] = chunk
 	return chunk
 }
 
+// chunkBounds returns the area covered by the chunk at x, y, which is empty
+// past the edges of the sandbox.
+func (s *Sandbox) chunkBounds(x, y int) image.Rectangle {
+	r := image.Rect(x*s.cWidth, y*s.cHeight, (x+1)*s.cWidth, (y+1)*s.cHeight)
+	if s.Bounded() {
+		r = r.Intersect(image.Rect(0, 0, s.width, s.height))
+	}
+	return r
+}
+
+// GetChunkLocation returns the location of the chunk holding x, y.
 func (s *Sandbox) GetChunkLocation(x, y int) (int, int) {
-	return x / s.cWidth, y / s.cHeight
+	return floorDiv(x, s.cWidth), floorDiv(y, s.cHeight)
+}
+
+// floorDiv divides a by b rounding down, so negative coordinates fall into
+// the chunks before 0.
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
 }
 
 func (s *Sandbox) InBounds(x, y int) bool {
@@ -88,6 +284,101 @@ func (s *Sandbox) SetCell(x, y int, cell *Cell) {
 	}
 }
 
+// Paint fills a square brush of the given size along the line from x0, y0
+// to x1, y1 with new cells of cType. Only empty cells are filled, unless
+// cType is AIR, which erases.
+func (s *Sandbox) Paint(x0, y0, x1, y1, size int, cType CellType) {
+	s.paint(x0, y0, x1, y1, size, cType, nil)
+}
+
+// paint is Paint calling replaced, if not nil, with every cell it replaces.
+func (s *Sandbox) paint(x0, y0, x1, y1, size int, cType CellType, replaced func(x, y int, old *Cell)) {
+	dx := misc.Abs(x1 - x0)
+	sx := -1
+	if x0 < x1 {
+		sx = 1
+	}
+	dy := -misc.Abs(y1 - y0)
+	sy := -1
+	if y0 < y1 {
+		sy = 1
+	}
+	err := dx + dy
+	for {
+		for x := x0 - size/2; x < x0+size/2; x++ {
+			for y := y0 - size/2; y < y0+size/2; y++ {
+				if s.inWorld(x, y) && (cType == AIR || s.IsEmpty(x, y)) {
+					if replaced != nil {
+						replaced(x, y, s.GetCell(x, y))
+					}
+					s.SetCell(x, y, s.NewCell(cType))
+				}
+			}
+		}
+		if x0 == x1 && y0 == y1 {
+			break
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+// Cleared returns an empty sandbox with the size, seed, ambient temperature
+// and rate, and view of s. Its chunks are unloaded to memory until it's given a store.
+func (s *Sandbox) Cleared() *Sandbox {
+	c := NewSandbox(s.Config())
+	c.ambient, c.ambientRate = s.ambient, s.ambientRate
+	c.view = s.view
+	return c
+}
+
+// Rechunked returns a copy of s split into chunks of the given size, so chunk
+// sizes can be compared on the same sandbox.
+func (s *Sandbox) Rechunked(chunkWidth, chunkHeight int) (*Sandbox, error) {
+	config := s.Config()
+	config.ChunkWidth, config.ChunkHeight = chunkWidth, chunkHeight
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	chunks, err := s.allChunks()
+	if err != nil {
+		return nil, err
+	}
+	state, err := s.rand.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	r := NewSandbox(config)
+	r.tick = s.tick
+	r.ambient, r.ambientRate = s.ambient, s.ambientRate
+	r.view = s.view
+	if err := r.rand.UnmarshalBinary(state); err != nil {
+		return nil, err
+	}
+	for _, c := range chunks {
+		for i, cell := range c.cells {
+			if isEmpty(cell) {
+				continue
+			}
+			cell := *cell
+			r.SetCell(i%c.Width+c.left, i/c.Width+c.top, &cell)
+		}
+	}
+	for _, c := range r.Chunks {
+		c.UpdateRect()
+	}
+	r.sortChunks()
+	return r, nil
+}
+
 func (s *Sandbox) MoveCell(x, y, xn, yn int) {
 	src := s.GetChunk(x, y)
 	dst := s.GetChunk(xn, yn)
@@ -100,79 +391,149 @@ func (s *Sandbox) RemoveEmptyChunks() {
 	for i := 0; i < len(s.Chunks); i++ {
 		chunk := s.Chunks[i]
 		if chunk.filledCells == 0 {
-			s.chunkLookup.Remove(hash(chunk.X, chunk.Y))
-			s.chunkMutex.Lock()
+			delete(s.chunkLookup, [2]int{chunk.X, chunk.Y})
 			s.Chunks = append(s.Chunks[:i], s.Chunks[i+1:]...)
-			s.chunkMutex.Unlock()
 			i--
 
 			chunk = nil
 		} else if chunk != nil {
-			if !s.chunkLookup.Has(hash(chunk.X, chunk.Y)) {
-				s.chunkMutex.Lock()
+			if _, ok := s.chunkLookup[[2]int{chunk.X, chunk.Y}]; !ok {
 				s.Chunks = append(s.Chunks[:i], s.Chunks[i+1:]...)
-				s.chunkMutex.Unlock()
 			}
 		}
 	}
 }
 
-func (s *Sandbox) MoveUpdate() {
-	var wg sync.WaitGroup
-	for _, chunk := range s.Chunks {
-		wg.Add(1)
-		go func(s *Sandbox, c *Chunk) {
-			NewWorker(s, c).UpdateChunk()
-			wg.Done()
-		}(s, chunk)
+// nearChunks returns the area covered by the chunk at x, y and the chunks
+// around it.
+func (s *Sandbox) nearChunks(x, y int) image.Rectangle {
+	r := image.Rect((x-1)*s.cWidth, (y-1)*s.cHeight, (x+2)*s.cWidth, (y+2)*s.cHeight)
+	if s.Bounded() {
+		r = r.Intersect(image.Rect(0, 0, s.width, s.height))
 	}
-	wg.Wait()
+	return r
+}
 
+// phases splits the chunks in the four phases of a checkerboard, keeping
+// their order. The chunks of a phase are two chunks apart, so none of them is
+// around another: workers can read the chunks around theirs while the phase
+// runs, as nothing changes them until it ends.
+func (s *Sandbox) phases() [4][]*Chunk {
+	for p := range s.phaseChunks {
+		s.phaseChunks[p] = s.phaseChunks[p][:0]
+	}
 	for _, chunk := range s.Chunks {
-		wg.Add(1)
-		go func(c *Chunk) {
-			c.ApplyChanges()
-			wg.Done()
-		}(chunk)
+		p := chunk.X&1 + chunk.Y&1*2
+		s.phaseChunks[p] = append(s.phaseChunks[p], chunk)
 	}
-	wg.Wait()
+	return s.phaseChunks
+}
 
-	for _, chunk := range s.Chunks {
-		chunk.UpdateRect()
+// runPhases runs update on every chunk, one phase at a time. What the
+// workers of a phase left for other chunks is merged, and the moves applied,
+// before the next phase starts, which sees where the cells ended.
+func (s *Sandbox) runPhases(update func(w *Worker)) {
+	for _, phase := range s.phases() {
+		outboxes := pool.each(s, phase, update)
+
+		chunks := len(s.Chunks)
+		for _, o := range outboxes {
+			s.merge(o)
+		}
+		if len(s.Chunks) != chunks {
+			s.sortChunks()
+		}
+
+		// Changes can swap cells with other chunks, so they are applied one
+		// chunk at a time to keep the result independent of timing.
+		for _, chunk := range s.Chunks {
+			if len(chunk.changes) > 0 {
+				chunk.ApplyChanges()
+			}
+		}
 	}
 }
 
-func (s *Sandbox) TempUpdate() {
-	var wg sync.WaitGroup
-	for _, chunk := range s.Chunks {
-		wg.Add(1)
-		go func(s *Sandbox, c *Chunk) {
-			NewWorker(s, c).UpdateChunkTemp()
-			wg.Done()
-		}(s, chunk)
+// merge applies what a worker left for the chunks around its own, creating
+// them if needed.
+func (s *Sandbox) merge(o outbox) {
+	for _, r := range o.sets {
+		if s.GetCell(r.x, r.y) == r.old {
+			s.SetCell(r.x, r.y, r.cell)
+		}
+	}
+	for _, e := range o.edits {
+		e.edit(e.cell)
+	}
+	for _, p := range o.pings {
+		s.KeepAlive(p.X, p.Y)
+	}
+	for _, m := range o.moves {
+		if dst := s.GetChunk(m.x, m.y); dst != nil {
+			m.change.dst = dst.GetIndex(m.x, m.y)
+			dst.changes = append(dst.changes, m.change)
+		}
 	}
-	wg.Wait()
 }
 
-func (s *Sandbox) StateUpdate() {
-	var wg sync.WaitGroup
+// MoveUpdate moves the cells of every chunk.
+func (s *Sandbox) MoveUpdate() {
+	poolMutex.Lock()
+	defer poolMutex.Unlock()
+	s.runPhases((*Worker).UpdateChunk)
 	for _, chunk := range s.Chunks {
-		wg.Add(1)
-		go func(s *Sandbox, c *Chunk) {
-			NewWorker(s, c).UpdateChunkState()
-			wg.Done()
-		}(s, chunk)
+		chunk.UpdateRect()
 	}
-	wg.Wait()
+}
+
+// Ambient returns the temperature every cell slowly relaxes toward.
+func (s *Sandbox) Ambient() float64 {
+	return s.ambient
+}
+
+func (s *Sandbox) SetAmbient(temp float64) {
+	s.ambient = temp
+	s.wakeHeat()
+}
+
+// AmbientRate returns the fraction of the difference with the ambient
+// temperature the cells lose every tick.
+func (s *Sandbox) AmbientRate() float64 {
+	return s.ambientRate
+}
+
+// SetAmbientRate sets the fraction of the difference with the ambient
+// temperature the cells lose every tick, between 0 and 1. With 0 the cells
+// don't relax toward the ambient temperature and the sandbox keeps its heat.
+func (s *Sandbox) SetAmbientRate(rate float64) {
+	s.ambientRate = misc.Clamp(rate, 0, 1)
+	s.wakeHeat()
+}
+
+// StateUpdate changes the cells by their temperature, reactions and
+// behaviours, in the same phases as the moves.
+func (s *Sandbox) StateUpdate() {
+	poolMutex.Lock()
+	defer poolMutex.Unlock()
+	s.runPhases((*Worker).UpdateChunkState)
 }
 
 func (s *Sandbox) Update(temp bool) {
 	s.RemoveEmptyChunks()
+	s.streamChunks()
+	s.sortChunks()
+	for _, chunk := range s.Chunks {
+		chunk.rand = s.chunkRand(chunk.X, chunk.Y)
+	}
+	s.PressureUpdate()
+	s.ElectricUpdate()
 	s.MoveUpdate()
 	if temp {
 		s.TempUpdate()
 	}
 	s.StateUpdate()
+	s.applyExplosions()
+	s.tick++
 }
 
 func (s *Sandbox) KeepAlive(x, y int) {
@@ -182,51 +543,107 @@ func (s *Sandbox) KeepAlive(x, y int) {
 	}
 }
 
-func (s *Sandbox) Draw(pix []byte, screenWidth int, temp bool) {
+// Draw draws the cells within view into pix, the RGBA pixels of an image of
+// the size of view. Unloaded chunks within view are read back from the store
+// the first time they are drawn, and their pixels kept until they leave view.
+func (s *Sandbox) Draw(pix []byte, view image.Rectangle, temp bool) {
+	for i := range pix {
+		pix[i] = 0
+	}
 	for _, c := range s.Chunks {
-		for i, cell := range c.cells {
-			x := i%c.Width + c.X*c.Width
-			y := i/c.Width + c.Y*c.Height
-			idx := (x + y*screenWidth)
-			if isEmpty(cell) {
-				pix[idx*4] = 0
-				pix[idx*4+1] = 0
-				pix[idx*4+2] = 0
-				pix[idx*4+3] = 0
+		if c.Bounds().Overlaps(view) {
+			c.draw(pix, view, temp)
+		}
+	}
+	for key, cached := range s.unloadedPix {
+		if cached.temp != temp || !s.chunkBounds(key[0], key[1]).Overlaps(view) {
+			delete(s.unloadedPix, key)
+		}
+	}
+	for key := range s.unloaded {
+		area := s.chunkBounds(key[0], key[1])
+		if !area.Overlaps(view) {
+			continue
+		}
+		cached, ok := s.unloadedPix[key]
+		if !ok {
+			c := NewChunk(key[0], key[1], area)
+			if err := s.readUnloaded(c); err != nil {
+				log.Printf("chunk %d,%d: %v", c.X, c.Y, err)
 				continue
 			}
+			cached = chunkPixels{temp: temp, pix: make([]byte, area.Dx()*area.Dy()*4)}
+			c.draw(cached.pix, area, temp)
+			s.unloadedPix[key] = cached
+		}
+		copyPixels(pix, view, cached.pix, area)
+	}
+}
 
-			r := 0
-			g := 0
-			b := 0
+// chunkPixels are the pixels of an unloaded chunk, drawn with or without
+// temperatures.
+type chunkPixels struct {
+	temp bool
+	pix  []byte
+}
 
-			if temp {
-				if cell.temp < 0 {
-					b = -cell.temp
-					g = -cell.temp / 30
-				} else {
-					r = cell.temp
-				}
-			}
+// copyPixels copies the RGBA pixels src of the area from into the ones dst of
+// the area to, where they overlap.
+func copyPixels(dst []byte, to image.Rectangle, src []byte, from image.Rectangle) {
+	r := to.Intersect(from)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		d := ((y-to.Min.Y)*to.Dx() + r.Min.X - to.Min.X) * 4
+		s := ((y-from.Min.Y)*from.Dx() + r.Min.X - from.Min.X) * 4
+		copy(dst[d:d+r.Dx()*4], src[s:s+r.Dx()*4])
+	}
+}
+
+// draw draws the cells of the chunk within view into pix, as Sandbox.Draw.
+func (c *Chunk) draw(pix []byte, view image.Rectangle, temp bool) {
+	for i, cell := range c.cells {
+		x := i%c.Width + c.left
+		y := i/c.Width + c.top
+		if isEmpty(cell) || !(image.Point{x, y}).In(view) {
+			continue
+		}
+		idx := (x - view.Min.X) + (y-view.Min.Y)*view.Dx()
+
+		r := 0
+		g := 0
+		b := 0
 
-			if cell.CType == FIRE {
-				g += cell.extraData1
-				r -= cell.extraData2 / 3
-				g -= cell.extraData2 / 3
-				b -= cell.extraData2 / 3
+		if temp {
+			temp := int(cell.temp)
+			if temp < 0 {
+				b = -temp
+				g = -temp / 30
+			} else {
+				r = temp
 			}
-			cR := cell.BaseColor().R
-			cG := cell.BaseColor().G
-			cB := cell.BaseColor().B
-			cA := cell.BaseColor().A
-			r = int(cR) + r + cell.colorOffset
-			g = int(cG) + g + cell.colorOffset
-			b = int(cB) + b + cell.colorOffset
-
-			pix[idx*4] = uint8(misc.Clamp(r, 0, 255))
-			pix[idx*4+1] = uint8(misc.Clamp(g, 0, 255))
-			pix[idx*4+2] = uint8(misc.Clamp(b, 0, 255))
-			pix[idx*4+3] = cA
 		}
+
+		if cell.CType == FIRE {
+			g += cell.extraData1
+			r -= cell.extraData2 / 3
+			g -= cell.extraData2 / 3
+			b -= cell.extraData2 / 3
+		}
+		if cell.Powered() {
+			r += 120
+			g += 120
+			b += 60
+		}
+		cR := cell.BaseColor().R
+		cG := cell.BaseColor().G
+		cB := cell.BaseColor().B
+		cA := cell.BaseColor().A
+		r = int(cR) + r + cell.colorOffset
+		g = int(cG) + g + cell.colorOffset
+		b = int(cB) + b + cell.colorOffset
+
+		pix[idx*4] = uint8(misc.Clamp(r, 0, 255))
+		pix[idx*4+1] = uint8(misc.Clamp(g, 0, 255))
+		pix[idx*4+2] = uint8(misc.Clamp(b, 0, 255))
+		pix[idx*4+3] = cA
 	}
 }
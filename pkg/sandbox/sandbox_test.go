@@ -0,0 +1,126 @@
+package sandbox
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newTestSandbox returns a sandbox of width by height cells in chunks of
+// the default size.
+func newTestSandbox(t testing.TB, width, height int) *Sandbox {
+	t.Helper()
+	return NewSandbox(SandboxConfig{
+		Width:       width,
+		Height:      height,
+		ChunkWidth:  DefaultChunkSize,
+		ChunkHeight: DefaultChunkSize,
+		Seed:        1,
+	})
+}
+
+// walls surrounds the cells of the rectangle from x0, y0 to x1, y1 with WALL.
+func walls(s *Sandbox, x0, y0, x1, y1 int) {
+	for x := x0 - 1; x <= x1+1; x++ {
+		s.SetCell(x, y0-1, s.NewCell(WALL))
+		s.SetCell(x, y1+1, s.NewCell(WALL))
+	}
+	for y := y0; y <= y1; y++ {
+		s.SetCell(x0-1, y, s.NewCell(WALL))
+		s.SetCell(x1+1, y, s.NewCell(WALL))
+	}
+}
+
+// count returns how many cells of s are cType.
+func count(s *Sandbox, cType CellType) int {
+	n := 0
+	for _, c := range s.Chunks {
+		for _, cell := range c.cells {
+			if !isEmpty(cell) && cell.CType == cType {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// restoreMaterials puts the registry of the simulation back the way it was
+// at the end of the test, for tests loading materials into it.
+func restoreMaterials(t testing.TB) {
+	t.Helper()
+	materials := append([]*Material{}, Materials.materials...)
+	names := map[string]CellType{}
+	for name, cType := range Materials.names {
+		names[name] = cType
+	}
+	t.Cleanup(func() {
+		Materials.materials, Materials.names = materials, names
+	})
+}
+
+// mixedScene returns a game sized sandbox with rows of falling, flowing,
+// burning and growing materials over a floor.
+func mixedScene(t testing.TB, seed uint64) *Sandbox {
+	t.Helper()
+	s := NewSandbox(SandboxConfig{Width: 590, Height: 430, ChunkWidth: 59, ChunkHeight: 43, Seed: seed})
+	types := []CellType{SAND, WATER, OIL, PLANT, STONE, SMOKE, FIRE, WOOD, LAVA, ICE, ACID, GUNP}
+	for x := 0; x < 590; x++ {
+		s.SetCell(x, 420, s.NewCell(WALL))
+	}
+	for x := 20; x < 560; x++ {
+		for y := 20; y < 200; y += 3 {
+			s.SetCell(x, y, s.NewCell(types[(x/7+y)%len(types)]))
+		}
+	}
+	return s
+}
+
+// sameCells fails the test at the first cell that differs between a and b.
+func sameCells(t *testing.T, a, b *Sandbox) {
+	t.Helper()
+	r := a.Bounds().Union(b.Bounds())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			ca, cb := a.GetCell(x, y), b.GetCell(x, y)
+			if isEmpty(ca) && isEmpty(cb) {
+				continue
+			}
+			if isEmpty(ca) || isEmpty(cb) || *ca != *cb {
+				t.Fatalf("cells at %d, %d differ: %+v and %+v", x, y, ca, cb)
+			}
+		}
+	}
+}
+
+func TestSameSeedSameSandbox(t *testing.T) {
+	a, b := mixedScene(t, 7), mixedScene(t, 7)
+	// Both are updated at once, sharing the workers.
+	var wg sync.WaitGroup
+	for _, s := range []*Sandbox{a, b} {
+		wg.Add(1)
+		go func(s *Sandbox) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				s.Update(true)
+			}
+		}(s)
+	}
+	wg.Wait()
+	sameCells(t, a, b)
+}
+
+func TestMinChunkSize(t *testing.T) {
+	for _, size := range []int{MinChunkSize - 1, MinChunkSize} {
+		err := SandboxConfig{Width: 100, Height: 100, ChunkWidth: size, ChunkHeight: DefaultChunkSize}.Validate()
+		if (err == nil) != (size >= MinChunkSize) {
+			t.Errorf("chunks %d wide: %v", size, err)
+		}
+	}
+
+	err := Materials.Load(strings.NewReader(`[
+		{"name": "FLUX", "color": "#ffffff", "movement": "liquid", "dispersion": 9}
+	]`))
+	if err == nil {
+		t.Fatal("loaded a dispersion farther than the chunks around")
+	}
+}
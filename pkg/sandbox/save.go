@@ -0,0 +1,408 @@
+package sandbox
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Save files start with saveMagic and saveVersion, followed by the sandbox
+// settings, the names of the materials used and the chunks. Chunk cells are
+// stored as runs of empty cells, each followed by one cell, after the dirty
+// rects, pressure and whether the heat of the chunk is awake. Version 1 had
+// no chunk size, as it was derived from the size of the sandbox, versions
+// before 3 no ambient rate, and versions before 4 neither the state of the
+// chunks nor the tick cells last moved in, so they didn't go on exactly as
+// saved.
+const (
+	saveMagic   = "SBOX"
+	saveVersion = 4
+
+	// v1Chunks is the number of chunks along each side of version 1 saves.
+	v1Chunks = 10
+	// maxLoadCells is the most cells a save can have, so a few bytes
+	// declaring many large chunks don't take all the memory.
+	maxLoadCells = 1 << 24
+)
+
+type saveWriter struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (w *saveWriter) uvarint(v uint64) {
+	w.w.Write(w.buf[:binary.PutUvarint(w.buf[:], v)])
+}
+
+func (w *saveWriter) varint(v int64) {
+	w.w.Write(w.buf[:binary.PutVarint(w.buf[:], v)])
+}
+
+func (w *saveWriter) float(f float64) {
+	binary.LittleEndian.PutUint64(w.buf[:8], math.Float64bits(f))
+	w.w.Write(w.buf[:8])
+}
+
+func (w *saveWriter) bytes(b []byte) {
+	w.uvarint(uint64(len(b)))
+	w.w.Write(b)
+}
+
+// Save writes the sandbox to w, along with its unloaded chunks.
+func (s *Sandbox) Save(w io.Writer) error {
+	chunks, err := s.allChunks()
+	if err != nil {
+		return err
+	}
+
+	sw := &saveWriter{w: bufio.NewWriter(w)}
+	sw.w.WriteString(saveMagic)
+	sw.uvarint(saveVersion)
+
+	sw.uvarint(uint64(s.width))
+	sw.uvarint(uint64(s.height))
+	sw.uvarint(uint64(s.cWidth))
+	sw.uvarint(uint64(s.cHeight))
+	sw.uvarint(s.seed)
+	sw.uvarint(s.tick)
+	sw.float(s.ambient)
+	sw.float(s.ambientRate)
+	state, err := s.rand.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	sw.bytes(state)
+
+	index := sw.materials(chunks)
+	sw.uvarint(uint64(len(chunks)))
+	for _, c := range chunks {
+		sw.varint(int64(c.X))
+		sw.varint(int64(c.Y))
+		sw.chunk(c, index)
+	}
+	return sw.w.Flush()
+}
+
+// materials writes the names of the materials of the chunks, and returns
+// their indices. Only the materials in use are stored, so their indices stay
+// small.
+func (w *saveWriter) materials(chunks []*Chunk) map[CellType]uint64 {
+	index := map[CellType]uint64{}
+	var names []string
+	for _, c := range chunks {
+		for _, cell := range c.cells {
+			if isEmpty(cell) {
+				continue
+			}
+			if _, ok := index[cell.CType]; !ok {
+				index[cell.CType] = uint64(len(names))
+				names = append(names, cell.CType.String())
+			}
+		}
+	}
+	w.uvarint(uint64(len(names)))
+	for _, name := range names {
+		w.bytes([]byte(name))
+	}
+	return index
+}
+
+// chunk writes the dirty rects, pressure and heat state of c, followed by
+// its cells.
+func (w *saveWriter) chunk(c *Chunk, index map[CellType]uint64) {
+	for _, v := range c.rects() {
+		w.varint(int64(v))
+	}
+	for _, p := range c.pressure.pressure {
+		w.float(p)
+	}
+	if c.heatAwake {
+		w.w.WriteByte(1)
+	} else {
+		w.w.WriteByte(0)
+	}
+
+	empty := uint64(0)
+	for _, cell := range c.cells {
+		if isEmpty(cell) {
+			empty++
+			continue
+		}
+		w.uvarint(empty)
+		empty = 0
+		w.uvarint(index[cell.CType])
+		w.varint(int64(cell.colorOffset))
+		w.float(cell.temp)
+		w.varint(int64(cell.extraData1))
+		w.varint(int64(cell.extraData2))
+		w.float(cell.velX)
+		w.float(cell.velY)
+		w.w.WriteByte(byte(cell.spark))
+		w.uvarint(cell.moved)
+	}
+	w.uvarint(empty)
+}
+
+// rects returns the dirty rect of c and the one being built.
+func (c *Chunk) rects() [8]int {
+	return [8]int{c.MinX, c.MinY, c.MaxX, c.MaxY, c.minXw, c.minYw, c.maxXw, c.maxYw}
+}
+
+type saveReader struct {
+	r       *bufio.Reader
+	version uint64
+	err     error
+}
+
+func (r *saveReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(r.r)
+	r.err = err
+	return v
+}
+
+func (r *saveReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(r.r)
+	r.err = err
+	return v
+}
+
+// size reads a size, which is -1 if it doesn't fit in 32 bits.
+func (r *saveReader) size() int {
+	v := r.uvarint()
+	if v > math.MaxInt32 {
+		return -1
+	}
+	return int(v)
+}
+
+func (r *saveReader) float() float64 {
+	var buf [8]byte
+	if r.err == nil {
+		_, r.err = io.ReadFull(r.r, buf[:])
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(buf[:]))
+}
+
+func (r *saveReader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	b, err := r.r.ReadByte()
+	r.err = err
+	return b
+}
+
+func (r *saveReader) bytes(max int) []byte {
+	n := r.uvarint()
+	if r.err != nil {
+		return nil
+	}
+	if n > uint64(max) {
+		r.err = fmt.Errorf("field of %d bytes is too long", n)
+		return nil
+	}
+	b := make([]byte, n)
+	_, r.err = io.ReadFull(r.r, b)
+	return b
+}
+
+// Load reads a sandbox written by Sandbox.Save.
+func Load(r io.Reader) (*Sandbox, error) {
+	sr := &saveReader{r: bufio.NewReader(r)}
+	magic := make([]byte, len(saveMagic))
+	if _, err := io.ReadFull(sr.r, magic); err != nil || string(magic) != saveMagic {
+		return nil, errors.New("not a sandbox save file")
+	}
+	version := sr.uvarint()
+	if sr.err == nil && (version < 1 || version > saveVersion) {
+		return nil, fmt.Errorf("unsupported save version %d", version)
+	}
+	sr.version = version
+
+	config := SandboxConfig{Width: sr.size(), Height: sr.size()}
+	if version > 1 {
+		config.ChunkWidth, config.ChunkHeight = sr.size(), sr.size()
+	} else {
+		config.ChunkWidth, config.ChunkHeight = config.Width/v1Chunks, config.Height/v1Chunks
+	}
+	config.Seed = sr.uvarint()
+	tick := sr.uvarint()
+	ambient, ambientRate := sr.float(), DefaultAmbientRate
+	if version > 2 {
+		ambientRate = sr.float()
+	}
+	state := sr.bytes(1024)
+	if sr.err != nil {
+		return nil, sr.err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	s := NewSandbox(config)
+	s.tick = tick
+	s.ambient = ambient
+	s.SetAmbientRate(ambientRate)
+	if err := s.rand.UnmarshalBinary(state); err != nil {
+		return nil, err
+	}
+
+	types, err := sr.materials()
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := sr.uvarint()
+	if sr.err == nil && chunks > uint64(maxLoadCells/(config.ChunkWidth*config.ChunkHeight)) {
+		return nil, fmt.Errorf("%d chunks of %dx%d cells are too many", chunks, config.ChunkWidth, config.ChunkHeight)
+	}
+	for i := uint64(0); i < chunks && sr.err == nil; i++ {
+		x, y := int(sr.varint()), int(sr.varint())
+		if sr.err != nil {
+			break
+		}
+		if _, ok := s.chunkLookup[[2]int{x, y}]; ok {
+			return nil, fmt.Errorf("chunk %d,%d saved twice", x, y)
+		}
+		c := s.CreateChunk(x, y)
+		if c == nil {
+			return nil, fmt.Errorf("chunk %d,%d out of bounds", x, y)
+		}
+		if err := sr.chunk(c, types); err != nil {
+			return nil, fmt.Errorf("chunk %d,%d: %w", x, y, err)
+		}
+	}
+	if sr.err != nil {
+		return nil, sr.err
+	}
+	s.sortChunks()
+	return s, nil
+}
+
+// materials reads the names of the materials written by saveWriter.materials.
+func (r *saveReader) materials() ([]CellType, error) {
+	n := r.uvarint()
+	if r.err == nil && n > uint64(len(Materials.Types())) {
+		return nil, fmt.Errorf("too many materials")
+	}
+	types := make([]CellType, n)
+	for i := range types {
+		name := string(r.bytes(64))
+		if r.err != nil {
+			return nil, r.err
+		}
+		cType, ok := Materials.Lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown material %q", name)
+		}
+		types[i] = cType
+	}
+	return types, r.err
+}
+
+// encodeChunk returns the cells of c the way they are saved, along with the
+// names of their materials.
+func encodeChunk(c *Chunk) ([]byte, error) {
+	var buf bytes.Buffer
+	w := &saveWriter{w: bufio.NewWriter(&buf)}
+	w.chunk(c, w.materials([]*Chunk{c}))
+	err := w.w.Flush()
+	return buf.Bytes(), err
+}
+
+// decodeChunk fills c with the cells encoded by encodeChunk.
+func decodeChunk(c *Chunk, data []byte) error {
+	r := &saveReader{r: bufio.NewReader(bytes.NewReader(data)), version: saveVersion}
+	types, err := r.materials()
+	if err != nil {
+		return err
+	}
+	return r.chunk(c, types)
+}
+
+// chunk reads a chunk written by saveWriter.chunk into c. The chunks of
+// saves before version 4 have all their cells and heat awake and no
+// pressure.
+func (r *saveReader) chunk(c *Chunk, types []CellType) error {
+	var rects [8]int
+	if r.version > 3 {
+		for i := range rects {
+			rects[i] = int(r.varint())
+		}
+		for i := range c.pressure.pressure {
+			c.pressure.pressure[i] = r.float()
+		}
+		c.heatAwake = r.byte() != 0
+		if r.err != nil {
+			return r.err
+		}
+		for i, v := range rects {
+			// Rects end past the last cell, and are empty from -1 once
+			// reset.
+			size := c.Width
+			if i%2 == 1 {
+				size = c.Height
+			}
+			if v < -1 || v > size {
+				return fmt.Errorf("invalid dirty rect %v", rects)
+			}
+		}
+	}
+	if err := r.cells(c, types); err != nil {
+		return err
+	}
+	if r.version > 3 {
+		c.MinX, c.MinY, c.MaxX, c.MaxY = rects[0], rects[1], rects[2], rects[3]
+		c.minXw, c.minYw, c.maxXw, c.maxYw = rects[4], rects[5], rects[6], rects[7]
+	} else {
+		c.UpdateRect()
+	}
+	return nil
+}
+
+func (r *saveReader) cells(c *Chunk, types []CellType) error {
+	for i := 0; ; i++ {
+		empty := r.uvarint()
+		if r.err != nil {
+			return r.err
+		}
+		if empty > uint64(len(c.cells)-i) {
+			return errors.New("too many cells")
+		}
+		i += int(empty)
+		if i == len(c.cells) {
+			return nil
+		}
+
+		t := r.uvarint()
+		if r.err == nil && t >= uint64(len(types)) {
+			return fmt.Errorf("invalid material index %d", t)
+		}
+		cell := &Cell{
+			colorOffset: int(r.varint()),
+			temp:        r.float(),
+			extraData1:  int(r.varint()),
+			extraData2:  int(r.varint()),
+			velX:        r.float(),
+			velY:        r.float(),
+			spark:       sparkState(r.byte()),
+		}
+		if r.version > 3 {
+			cell.moved = r.uvarint()
+		}
+		if r.err != nil {
+			return r.err
+		}
+		cell.CType = types[t]
+		c.SetCellAt(i, cell)
+	}
+}
@@ -0,0 +1,180 @@
+package sandbox
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSaveLoad(t *testing.T) {
+	s := mixedScene(t, 5)
+	s.SetAmbient(35)
+	s.SetAmbientRate(0.01)
+	for i := 0; i < 10; i++ {
+		s.Update(true)
+	}
+	var buf bytes.Buffer
+	if err := s.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Config() != s.Config() || loaded.Tick() != s.Tick() {
+		t.Errorf("loaded %+v at tick %d, want %+v at tick %d", loaded.Config(), loaded.Tick(), s.Config(), s.Tick())
+	}
+	if loaded.Ambient() != s.Ambient() || loaded.AmbientRate() != s.AmbientRate() {
+		t.Errorf("loaded ambient %v at rate %v, want %v at rate %v", loaded.Ambient(), loaded.AmbientRate(), s.Ambient(), s.AmbientRate())
+	}
+	if loaded.rand.Uint64() != s.rand.Uint64() {
+		t.Error("the random source was loaded in another state")
+	}
+	sameCells(t, s, loaded)
+
+	for i := 0; i < 20; i++ {
+		s.Update(true)
+		loaded.Update(true)
+	}
+	sameCells(t, s, loaded)
+}
+
+// saveHeader returns a writer of a save of the given version, with the
+// settings of a 590x430 sandbox in 64x64 chunks written.
+func saveHeader(t *testing.T, version uint64) (*bytes.Buffer, *saveWriter) {
+	t.Helper()
+	var buf bytes.Buffer
+	w := &saveWriter{w: bufio.NewWriter(&buf)}
+	w.w.WriteString(saveMagic)
+	w.uvarint(version)
+	w.uvarint(590)
+	w.uvarint(430)
+	if version > 1 {
+		w.uvarint(64)
+		w.uvarint(64)
+	}
+	w.uvarint(7)
+	w.uvarint(42)
+	w.float(-10)
+	if version > 2 {
+		w.float(0.5)
+	}
+	state, err := newTestSandbox(t, 16, 16).rand.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.bytes(state)
+	return &buf, w
+}
+
+func TestLoadOldVersions(t *testing.T) {
+	tests := []struct {
+		version                 uint64
+		chunkWidth, chunkHeight int
+		ambientRate             float64
+	}{
+		// Version 1 saves were split in 10x10 chunks, and saves before
+		// version 3 relaxed at the default rate.
+		{1, 59, 43, DefaultAmbientRate},
+		{2, 64, 64, DefaultAmbientRate},
+		{3, 64, 64, 0.5},
+	}
+	for _, tt := range tests {
+		buf, w := saveHeader(t, tt.version)
+		w.uvarint(1)
+		w.bytes([]byte("SAND"))
+		w.uvarint(1)
+		w.varint(0)
+		w.varint(0)
+		w.uvarint(uint64(tt.chunkWidth * tt.chunkHeight))
+		w.w.Flush()
+
+		s, err := Load(buf)
+		if err != nil {
+			t.Fatalf("version %d: %v", tt.version, err)
+		}
+		if c := s.Config(); c.ChunkWidth != tt.chunkWidth || c.ChunkHeight != tt.chunkHeight || c.Width != 590 || c.Height != 430 || c.Seed != 7 {
+			t.Errorf("version %d: loaded %+v", tt.version, c)
+		}
+		if s.Tick() != 42 || s.Ambient() != -10 || s.AmbientRate() != tt.ambientRate {
+			t.Errorf("version %d: loaded tick %d, ambient %v at rate %v", tt.version, s.Tick(), s.Ambient(), s.AmbientRate())
+		}
+	}
+}
+
+func TestLoadInvalidSaves(t *testing.T) {
+	// chunk writes a chunk at x, y with the dirty rect r, whose first cell is
+	// of the material at index t.
+	chunk := func(w *saveWriter, x, y int, r [8]int, t uint64) {
+		w.varint(int64(x))
+		w.varint(int64(y))
+		for _, v := range r {
+			w.varint(int64(v))
+		}
+		for i := 0; i < 16*16; i++ {
+			w.float(0)
+		}
+		w.w.WriteByte(1)
+		w.uvarint(0)
+		w.uvarint(t)
+		w.varint(0)
+		w.float(20)
+		w.varint(0)
+		w.varint(0)
+		w.float(0)
+		w.float(0)
+		w.w.WriteByte(0)
+		w.uvarint(0)
+		w.uvarint(64*64 - 1)
+	}
+	awake := [8]int{0, 0, 64, 64, 64, 64, -1, -1}
+	tests := []struct {
+		name  string
+		write func(w *saveWriter)
+		err   string
+	}{
+		{"duplicate chunk", func(w *saveWriter) {
+			w.uvarint(2)
+			chunk(w, 1, 1, awake, 0)
+			chunk(w, 1, 1, awake, 0)
+		}, "chunk 1,1 saved twice"},
+		{"chunk out of bounds", func(w *saveWriter) {
+			w.uvarint(1)
+			chunk(w, 10, 0, awake, 0)
+		}, "chunk 10,0 out of bounds"},
+		{"material index", func(w *saveWriter) {
+			w.uvarint(1)
+			chunk(w, 0, 0, awake, 1)
+		}, "chunk 0,0: invalid material index 1"},
+		{"dirty rect", func(w *saveWriter) {
+			w.uvarint(1)
+			chunk(w, 0, 0, [8]int{0, 0, 65, 64, 0, 0, 0, 0}, 0)
+		}, "chunk 0,0: invalid dirty rect [0 0 65 64 0 0 0 0]"},
+		{"too many cells", func(w *saveWriter) {
+			w.uvarint(maxLoadCells/(64*64) + 1)
+		}, "4097 chunks of 64x64 cells are too many"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, w := saveHeader(t, saveVersion)
+			w.uvarint(1)
+			w.bytes([]byte("SAND"))
+			tt.write(w)
+			w.w.Flush()
+			if _, err := Load(buf); err == nil || err.Error() != tt.err {
+				t.Errorf("got error %v, want %s", err, tt.err)
+			}
+		})
+	}
+
+	if _, err := Load(strings.NewReader("SAVE\x03")); err == nil || err.Error() != "not a sandbox save file" {
+		t.Errorf("loaded a file with another magic: %v", err)
+	}
+	future, w := saveHeader(t, saveVersion+1)
+	w.w.Flush()
+	if _, err := Load(future); err == nil || err.Error() != "unsupported save version 5" {
+		t.Errorf("loaded a future version: %v", err)
+	}
+}
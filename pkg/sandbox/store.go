@@ -0,0 +1,190 @@
+package sandbox
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// Chunks within LoadDistance chunks of the view are loaded back, and chunks
+// farther than UnloadDistance are unloaded. The gap keeps chunks at the
+// border from being stored and loaded over and over.
+const (
+	LoadDistance   = 1
+	UnloadDistance = 3
+)
+
+// ChunkStore keeps the chunks unloaded from a sandbox, encoded as data.
+type ChunkStore interface {
+	Put(x, y int, data []byte) error
+	Get(x, y int) ([]byte, error)
+	Delete(x, y int) error
+}
+
+// DirStore is a ChunkStore keeping every chunk in a file of the directory.
+type DirStore string
+
+func (d DirStore) file(x, y int) string {
+	return filepath.Join(string(d), fmt.Sprintf("%d_%d.chunk", x, y))
+}
+
+func (d DirStore) Put(x, y int, data []byte) error {
+	return os.WriteFile(d.file(x, y), data, 0o644)
+}
+
+func (d DirStore) Get(x, y int) ([]byte, error) {
+	return os.ReadFile(d.file(x, y))
+}
+
+func (d DirStore) Delete(x, y int) error {
+	return os.Remove(d.file(x, y))
+}
+
+// memStore keeps the chunks in memory, for sandboxes without a store.
+type memStore map[[2]int][]byte
+
+func newMemStore() memStore {
+	return memStore{}
+}
+
+func (m memStore) Put(x, y int, data []byte) error {
+	m[[2]int{x, y}] = data
+	return nil
+}
+
+func (m memStore) Get(x, y int) ([]byte, error) {
+	data, ok := m[[2]int{x, y}]
+	if !ok {
+		return nil, fmt.Errorf("chunk %d,%d not stored", x, y)
+	}
+	return data, nil
+}
+
+func (m memStore) Delete(x, y int) error {
+	delete(m, [2]int{x, y})
+	return nil
+}
+
+// SetStore sets where the chunks far from the view are unloaded to, moving
+// the chunks already unloaded. A nil store keeps them in memory.
+func (s *Sandbox) SetStore(store ChunkStore) error {
+	if store == nil {
+		store = newMemStore()
+	}
+	for key := range s.unloaded {
+		data, err := s.store.Get(key[0], key[1])
+		if err != nil {
+			return err
+		}
+		if err := store.Put(key[0], key[1], data); err != nil {
+			return err
+		}
+	}
+	s.store = store
+	return nil
+}
+
+// SetView sets the area of the sandbox being looked at. From the next update,
+// chunks far from it are unloaded and stop being simulated. An empty view
+// keeps every chunk loaded.
+func (s *Sandbox) SetView(view image.Rectangle) {
+	s.view = view
+}
+
+// View returns the area of the sandbox being looked at.
+func (s *Sandbox) View() image.Rectangle {
+	return s.view
+}
+
+// chunkArea returns the locations of the chunks within d chunks of r.
+func (s *Sandbox) chunkArea(r image.Rectangle, d int) image.Rectangle {
+	x0, y0 := s.GetChunkLocation(r.Min.X, r.Min.Y)
+	x1, y1 := s.GetChunkLocation(r.Max.X-1, r.Max.Y-1)
+	return image.Rect(x0-d, y0-d, x1+1+d, y1+1+d)
+}
+
+// streamChunks unloads the chunks far from the view and loads back the ones
+// close to it.
+func (s *Sandbox) streamChunks() {
+	if s.view.Empty() {
+		return
+	}
+
+	far := s.chunkArea(s.view, UnloadDistance)
+	for i := 0; i < len(s.Chunks); i++ {
+		c := s.Chunks[i]
+		if (image.Point{c.X, c.Y}).In(far) {
+			continue
+		}
+		if err := s.unload(c); err != nil {
+			log.Printf("chunk %d,%d: %v", c.X, c.Y, err)
+			continue
+		}
+		s.Chunks = append(s.Chunks[:i], s.Chunks[i+1:]...)
+		i--
+	}
+
+	near := s.chunkArea(s.view, LoadDistance)
+	for y := near.Min.Y; y < near.Max.Y; y++ {
+		for x := near.Min.X; x < near.Max.X; x++ {
+			if s.unloaded[[2]int{x, y}] {
+				s.CreateChunk(x, y)
+			}
+		}
+	}
+}
+
+// unload stores c and removes it from the sandbox.
+func (s *Sandbox) unload(c *Chunk) error {
+	data, err := encodeChunk(c)
+	if err != nil {
+		return err
+	}
+	if err := s.store.Put(c.X, c.Y, data); err != nil {
+		return err
+	}
+	s.unloaded[[2]int{c.X, c.Y}] = true
+	delete(s.unloadedPix, [2]int{c.X, c.Y})
+	delete(s.chunkLookup, [2]int{c.X, c.Y})
+	return nil
+}
+
+// allChunks returns the chunks of the sandbox sorted by location, loading
+// copies of the unloaded ones.
+func (s *Sandbox) allChunks() ([]*Chunk, error) {
+	chunks := append([]*Chunk{}, s.Chunks...)
+	for key := range s.unloaded {
+		c := NewChunk(key[0], key[1], s.chunkBounds(key[0], key[1]))
+		if err := s.readUnloaded(c); err != nil {
+			return nil, fmt.Errorf("chunk %d,%d: %w", c.X, c.Y, err)
+		}
+		chunks = append(chunks, c)
+	}
+	sortChunks(chunks)
+	return chunks, nil
+}
+
+// readUnloaded fills c with the cells it was unloaded with.
+func (s *Sandbox) readUnloaded(c *Chunk) error {
+	data, err := s.store.Get(c.X, c.Y)
+	if err != nil {
+		return err
+	}
+	return decodeChunk(c, data)
+}
+
+// reload fills c with the cells it was unloaded with, and removes it from the
+// store. Its heat is woken up, as the ambient temperature may have changed
+// meanwhile.
+func (s *Sandbox) reload(c *Chunk) error {
+	key := [2]int{c.X, c.Y}
+	delete(s.unloaded, key)
+	delete(s.unloadedPix, key)
+	if err := s.readUnloaded(c); err != nil {
+		return err
+	}
+	c.heatAwake = true
+	return s.store.Delete(c.X, c.Y)
+}
@@ -1,195 +1,255 @@
 package sandbox
 
+import (
+	"image"
+
+	"pgregory.net/rand"
+)
+
+var directions = [][]int{
+	{0, -1}, // up
+	{0, 1},  // bottom
+	{1, 0},  // right
+	{-1, 0}, // left
+}
+
+// Worker updates one chunk at a time. Workers belong to the goroutines of a
+// Pool and are reused for every chunk they update.
 type Worker struct {
 	chunk   *Chunk
 	sandbox *Sandbox
+	rand    *rand.Rand
+
+	// near is the area of the chunk and the chunks around it, the only
+	// cells the worker reaches.
+	near image.Rectangle
+	// around holds the chunk and the chunks around it by their offset, so
+	// reading cells across its edges doesn't look chunks up in the sandbox.
+	around [3][3]*Chunk
+
+	// outbox buffers what the worker left for other chunks during a pass,
+	// and start is where the one of the current chunk begins.
+	outbox
+	start outbox
+}
+
+// outbox is what a worker left for the chunks around the one it updated,
+// merged after its phase.
+type outbox struct {
+	moves []move
+	sets  []replacement
+	edits []cellEdit
+	pings []image.Point
 }
 
-func NewWorker(sandbox *Sandbox, chunk *Chunk) *Worker {
-	return &Worker{
-		sandbox: sandbox,
-		chunk:   chunk,
+// move is a change queued for the cell at x, y, whose chunk may not exist
+// yet.
+type move struct {
+	x, y   int
+	change Change
+}
+
+// replacement is a cell queued to replace old at x, y. It's dropped if the
+// cell was replaced by another chunk first.
+type replacement struct {
+	x, y      int
+	old, cell *Cell
+}
+
+// cellEdit is a change queued for a cell of another chunk.
+type cellEdit struct {
+	cell *Cell
+	edit func(*Cell)
+}
+
+// begin sets the worker to update chunk. It draws random numbers from the
+// random source of the chunk, so a chunk must not have two workers at once.
+func (w *Worker) begin(sandbox *Sandbox, chunk *Chunk) {
+	w.sandbox = sandbox
+	w.chunk = chunk
+	w.rand = chunk.rand
+	w.near = sandbox.nearChunks(chunk.X, chunk.Y)
+	for dy := range w.around {
+		for dx := range w.around[dy] {
+			w.around[dy][dx] = sandbox.chunkLookup[[2]int{chunk.X + dx - 1, chunk.Y + dy - 1}]
+		}
 	}
+	w.start = w.outbox
+}
+
+// done returns what the worker left for other chunks while updating its
+// chunk. It stays valid until the buffers are reset.
+func (w *Worker) done() outbox {
+	return outbox{
+		moves: w.moves[len(w.start.moves):],
+		sets:  w.sets[len(w.start.sets):],
+		edits: w.edits[len(w.start.edits):],
+		pings: w.pings[len(w.start.pings):],
+	}
+}
+
+// reset empties the buffers of the worker, keeping their memory.
+func (w *Worker) reset() {
+	w.moves, w.sets, w.edits, w.pings = w.moves[:0], w.sets[:0], w.edits[:0], w.pings[:0]
+}
+
+// NewCell creates a cell drawing its random state from the worker.
+func (w *Worker) NewCell(cType CellType) *Cell {
+	return newCell(cType, w.rand)
 }
 
 func (w *Worker) InBounds(x, y int) bool {
-	return w.chunk.InBounds(x, y) || w.sandbox.InBounds(x, y)
+	return w.chunk.InBounds(x, y) || (image.Point{x, y}).In(w.near)
 }
 
 func (w *Worker) IsEmpty(x, y int) bool {
-	if w.chunk.InBounds(x, y) {
-		return w.chunk.IsEmpty(x, y)
-	}
-	return w.sandbox.IsEmpty(x, y)
+	return w.InBounds(x, y) && isEmpty(w.GetCell(x, y))
 }
 
+// GetCell returns the cell at x, y. It doesn't create missing chunks, whose
+// cells are nil, so it can read the chunks around while they are updated.
 func (w *Worker) GetCell(x, y int) *Cell {
 	if w.chunk.InBounds(x, y) {
 		return w.chunk.GetCell(x, y)
 	}
-	return w.sandbox.GetCell(x, y)
+	if !w.InBounds(x, y) {
+		return nil
+	}
+	if c := w.chunkAt(x, y); c != nil {
+		return c.GetCell(x, y)
+	}
+	return nil
 }
 
+// chunkAt returns the chunk holding x, y, or nil if it doesn't exist or
+// isn't around the chunk of the worker.
+func (w *Worker) chunkAt(x, y int) *Chunk {
+	cx, cy := w.sandbox.GetChunkLocation(x, y)
+	dx, dy := cx-w.chunk.X+1, cy-w.chunk.Y+1
+	if dx < 0 || dy < 0 || dx > 2 || dy > 2 {
+		return nil
+	}
+	if c := w.around[dy][dx]; c != nil && c.InBounds(x, y) {
+		return c
+	}
+	return nil
+}
+
+// SetCell replaces the cell at x, y. Cells of other chunks are replaced at
+// the end of the phase.
 func (w *Worker) SetCell(x, y int, cell *Cell) {
 	if w.chunk.InBounds(x, y) {
 		w.chunk.SetCell(x, y, cell)
-	} else {
-		w.sandbox.SetCell(x, y, cell)
+	} else if w.InBounds(x, y) {
+		w.sets = append(w.sets, replacement{x: x, y: y, old: w.GetCell(x, y), cell: cell})
+	}
+}
+
+// EditCell calls edit on the cell at x, y, which must not be empty. Cells of
+// other chunks are edited at the end of the phase.
+func (w *Worker) EditCell(x, y int, edit func(*Cell)) {
+	if w.chunk.InBounds(x, y) {
+		edit(w.chunk.GetCell(x, y))
+	} else if w.InBounds(x, y) {
+		w.edits = append(w.edits, cellEdit{cell: w.GetCell(x, y), edit: edit})
+	}
+}
+
+// keepAlive keeps the cell at x, y updating, queuing it if it's in another
+// chunk.
+func (w *Worker) keepAlive(x, y int) {
+	if w.chunk.InBounds(x, y) {
+		w.chunk.KeepAlive(x, y)
+	} else if w.InBounds(x, y) {
+		w.pings = append(w.pings, image.Point{x, y})
 	}
 }
 
+// MoveCell moves the cell at x, y, which must be in the chunk of the worker,
+// to dx, dy. Moves to other chunks are queued until the end of the phase.
 func (w *Worker) MoveCell(x, y, dx, dy int) {
 	pingX := 0
 	pingY := 0
 
-	if x == w.chunk.X*w.chunk.Width {
+	if x == w.chunk.left {
 		pingX = -1
 	}
-	if x == w.chunk.X*w.chunk.Width+w.chunk.Width-1 {
+	if x == w.chunk.left+w.chunk.Width-1 {
 		pingX = 1
 	}
-	if y == w.chunk.Y*w.chunk.Height {
+	if y == w.chunk.top {
 		pingY = -1
 	}
-	if y == w.chunk.Y*w.chunk.Height+w.chunk.Height-1 {
+	if y == w.chunk.top+w.chunk.Height-1 {
 		pingY = 1
 	}
 
 	if pingX != 0 {
-		w.sandbox.KeepAlive(x+pingX, y)
+		w.keepAlive(x+pingX, y)
 	}
 	if pingY != 0 {
-		w.sandbox.KeepAlive(x, y+pingY)
+		w.keepAlive(x, y+pingY)
 	}
 	if pingX != 0 && pingY != 0 {
-		w.sandbox.KeepAlive(x+pingX, y+pingY)
+		w.keepAlive(x+pingX, y+pingY)
 	}
 
-	if w.chunk.InBounds(x, y) && w.chunk.InBounds(dx, dy) {
+	if w.chunk.InBounds(dx, dy) {
 		w.chunk.MoveCell(w.chunk, x, y, dx, dy)
-	} else {
-		w.sandbox.MoveCell(x, y, dx, dy)
+		return
 	}
+	w.moves = append(w.moves, move{x: dx, y: dy, change: Change{
+		src:   w.chunk.GetIndex(x, y),
+		chunk: w.chunk,
+		cell:  w.chunk.GetCell(x, y),
+		other: w.GetCell(dx, dy),
+	}})
 }
 
 func (w *Worker) UpdateChunk() {
+	// Cells moved here by the chunks of earlier phases already moved this
+	// tick.
+	stamp := w.sandbox.tick + 1
 	for x := w.chunk.MinX; x < w.chunk.MaxX; x++ {
 		for y := w.chunk.MinY; y < w.chunk.MaxY; y++ {
 			c := w.chunk.GetCellAt(x + y*w.chunk.Width)
-			if isEmpty(c) {
+			if isEmpty(c) || c.moved == stamp {
 				continue
 			}
-			px := x + w.chunk.X*w.chunk.Width
-			py := y + w.chunk.Y*w.chunk.Height
-
-			switch c.CType {
-			case SAND:
-				if c.extraData1 == 0 {
-					w.MovePowder(px, py, c)
-				} else {
-					w.MoveSolid(px, py, c)
-				}
-			case WATER:
-				if c.temp > -80 {
-					w.MoveLiquid(px, py, c)
-				} else {
-					w.MoveSolid(px, py, c)
-				}
-			case GLASS:
-				if c.temp >= 30 {
-					w.MoveLiquid(px, py, c)
-				} else {
-					w.MoveSolid(px, py, c)
-				}
-			case STONE:
-				w.MoveSolid(px, py, c)
-			case SMOKE, STEAM:
-				w.MoveGas(px, py, c)
-			case FIRE:
-				w.MoveFire(px, py, c)
-			case PLANT:
-				if c.extraData2 == 0 {
-					w.MovePowder(px, py, c)
-				}
+			c.moved = stamp
+			px := x + w.chunk.left
+			py := y + w.chunk.top
+
+			if move := c.Material().Move; move != nil {
+				move(w, px, py, c)
 			}
 		}
 	}
 }
 
 func (w *Worker) UpdateChunkState() {
+	// Cells may change temperatures after the heat of the chunk went to
+	// sleep.
+	if w.chunk.awake() {
+		w.chunk.heatAwake = true
+	}
 	for x := w.chunk.MinX; x < w.chunk.MaxX; x++ {
 		for y := w.chunk.MinY; y < w.chunk.MaxY; y++ {
 			c := w.chunk.GetCellAt(x + y*w.chunk.Width)
 			if isEmpty(c) {
 				continue
 			}
-			px := x + w.chunk.X*w.chunk.Width
-			py := y + w.chunk.Y*w.chunk.Height
+			px := x + w.chunk.left
+			py := y + w.chunk.top
 			if c.CType == AIR {
 				continue
 			}
 
-			switch c.CType {
-			case SMOKE:
-				w.UpdateSmoke(px, py)
-			case STEAM:
-				w.UpdateSteam(px, py)
-			case WATER:
-				w.UpdateWater(px, py)
-			case SAND:
-				w.UpdateSand(px, py)
-			case FIRE:
-				w.UpdateFire(px, py)
-			case CLNE:
-				w.UpdateReplicator(px, py)
-			case PLANT:
-				w.UpdatePlant(px, py)
-			}
-		}
-	}
-}
-
-func (w *Worker) UpdateChunkTemp() {
-
-	directions := [][]int{
-		{0, -1}, // up
-		{0, 1},  // bottom
-		{1, 0},  // right
-		{-1, 0}, // left
-	}
-
-	for x := w.chunk.MinX; x < w.chunk.MaxX; x++ {
-		for y := w.chunk.MinY; y < w.chunk.MaxY; y++ {
-			c := w.chunk.GetCellAt(x + y*w.chunk.Width)
-			if isEmpty(c) {
-				continue
-			}
-			px := x + w.chunk.X*w.chunk.Width
-			py := y + w.chunk.Y*w.chunk.Height
-			if c.CType == AIR || c.temp == 0 {
+			if w.Transition(px, py, c) || w.React(px, py, c) {
 				continue
 			}
-			temp := c.temp
-			conductivity := c.ThermalConductivity()
-
-			for _, dir := range directions {
-				w.updateTemp(dir[0]+px, dir[1]+py, temp, conductivity, c.temp)
-			}
-
-		}
-	}
-}
-
-func (w *Worker) updateTemp(px, py, temp, conductivity, cTemp int) {
-	if w.InBounds(px, py) {
-		other := w.GetCell(px, py)
-		if !isEmpty(other) {
-			tc := conductivity + other.ThermalConductivity()
-			if tc > 0 {
-				t := temp / tc
-				cTemp -= t
-				other.temp += t
-				w.chunk.KeepAlive(px, py)
+			if update := c.Material().Update; update != nil {
+				update(w, px, py)
 			}
 		}
 	}
@@ -8,15 +8,26 @@ import (
 	"github.com/mrmarble/sandbox/pkg/sandbox"
 )
 
+const (
+	buttonWidth  = 35
+	buttonHeight = 18
+)
+
 type Menu struct {
 	x, y             int
+	columns          int
+	cellTypes        []sandbox.CellType
 	selectedCellType sandbox.CellType
 }
 
-func NewMenu(x, y int) *Menu {
+// NewMenu creates a menu at x, y wrapping its buttons into rows of the given
+// width.
+func NewMenu(x, y, width int) *Menu {
 	return &Menu{
 		x:                x,
 		y:                y,
+		columns:          width / buttonWidth,
+		cellTypes:        sandbox.Materials.Types(),
 		selectedCellType: sandbox.SAND,
 	}
 }
@@ -26,8 +37,10 @@ func (m *Menu) GetSelected() sandbox.CellType {
 }
 
 func (m *Menu) Draw(screen *ebiten.Image) {
-	for i := 0; i <= int(sandbox.AIR); i++ {
-		Button(screen, sandbox.CellType(i).String(), m.x+35*i, m.y, sandbox.CellType(i).Color(), m.selectedCellType == sandbox.CellType(i))
+	for i, cType := range m.cellTypes {
+		x := m.x + buttonWidth*(i%m.columns)
+		y := m.y + buttonHeight*(i/m.columns)
+		Button(screen, cType.String(), x, y, cType.Color(), m.selectedCellType == cType)
 	}
 }
 
@@ -35,12 +48,13 @@ func (m *Menu) Update() {
 	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
 		curX, curY := ebiten.CursorPosition()
 		if curY > m.y && curX > m.x {
-			x := curX - m.x
-			idx := int(math.Floor(float64(x) / 35))
-			if idx < 0 || idx > int(sandbox.AIR) {
+			col := int(math.Floor(float64(curX-m.x) / buttonWidth))
+			row := int(math.Floor(float64(curY-m.y) / buttonHeight))
+			idx := col + row*m.columns
+			if col >= m.columns || idx >= len(m.cellTypes) {
 				return
 			}
-			m.selectedCellType = sandbox.CellType(idx)
+			m.selectedCellType = m.cellTypes[idx]
 		}
 	}
 }